@@ -0,0 +1,268 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// BATCHING
+
+// RunFunc runs a model on feeds keyed by input name and returns its outputs
+// keyed by output name, like Model.RunContext.
+type RunFunc func(ctx context.Context, feeds map[string]*tf.Tensor) (map[string]*tf.Tensor, error)
+
+// BatchOptions configures a Batcher.
+type BatchOptions struct {
+	// MaxBatchSize is the largest number of rows run at once.
+	MaxBatchSize int `json:"max_batch_size" yaml:"max_batch_size"`
+	// MaxWait is how long the first request of a batch waits for others.
+	MaxWait time.Duration `json:"max_wait" yaml:"max_wait"`
+	// Workers is the number of batches run concurrently, 1 by default.
+	Workers int `json:"workers,omitempty" yaml:"workers,omitempty"`
+}
+
+// Batcher collects concurrent requests into batches. Every feed of a request
+// must have a leading batch dimension. Requests whose feeds have the same
+// keys, types and shapes apart from the batch dimension are stacked into one
+// tensor per input and run at once, and the outputs are split back along
+// their first dimension. Outputs without a batch dimension are returned
+// whole to every request.
+type Batcher struct {
+	run      RunFunc
+	options  BatchOptions
+	requests chan *batchRequest
+	workers  chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+type batchRequest struct {
+	ctx     context.Context
+	feeds   map[string]*tf.Tensor
+	rows    int64
+	results map[string]*tf.Tensor
+	err     error
+	done    chan struct{}
+}
+
+// NewBatcher returns a Batcher running batches with run.
+func NewBatcher(run RunFunc, options BatchOptions) *Batcher {
+	if options.MaxBatchSize <= 0 {
+		options.MaxBatchSize = 1
+	}
+	if options.Workers <= 0 {
+		options.Workers = 1
+	}
+	b := &Batcher{
+		run:      run,
+		options:  options,
+		requests: make(chan *batchRequest),
+		workers:  make(chan struct{}, options.Workers),
+	}
+	b.wg.Add(1)
+	go b.loop()
+	return b
+}
+
+// Run queues feeds into the next batch and waits for its outputs. It returns
+// early with the error of ctx if ctx is done; the batch still runs.
+func (b *Batcher) Run(ctx context.Context, feeds map[string]*tf.Tensor) (map[string]*tf.Tensor, error) {
+	rows, err := batchRows(feeds)
+	if err != nil {
+		return nil, err
+	}
+	req := &batchRequest{ctx: ctx, feeds: feeds, rows: rows, done: make(chan struct{})}
+
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return nil, fmt.Errorf("batcher is closed")
+	}
+	select {
+	case b.requests <- req:
+		b.mu.RUnlock()
+	case <-ctx.Done():
+		b.mu.RUnlock()
+		return nil, ctx.Err()
+	}
+
+	select {
+	case <-req.done:
+		return req.results, req.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close runs the queued requests and stops the batcher.
+func (b *Batcher) Close() error {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.requests)
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+	return nil
+}
+
+func (b *Batcher) loop() {
+	defer b.wg.Done()
+
+	var pending *batchRequest
+	for {
+		first := pending
+		pending = nil
+		if first == nil {
+			req, ok := <-b.requests
+			if !ok {
+				return
+			}
+			first = req
+		}
+
+		batch := []*batchRequest{first}
+		rows := first.rows
+		timer := time.NewTimer(b.options.MaxWait)
+	collect:
+		for rows < int64(b.options.MaxBatchSize) {
+			select {
+			case req, ok := <-b.requests:
+				if !ok {
+					break collect
+				}
+				if rows+req.rows > int64(b.options.MaxBatchSize) || !stackable(first.feeds, req.feeds) {
+					// Starts the next batch.
+					pending = req
+					break collect
+				}
+				batch = append(batch, req)
+				rows += req.rows
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		b.workers <- struct{}{}
+		b.wg.Add(1)
+		go func(batch []*batchRequest) {
+			defer func() {
+				<-b.workers
+				b.wg.Done()
+			}()
+			b.execute(batch)
+		}(batch)
+	}
+}
+
+// execute stacks the feeds of batch, runs them and splits the outputs back.
+func (b *Batcher) execute(batch []*batchRequest) {
+	defer func() {
+		for _, req := range batch {
+			close(req.done)
+		}
+	}()
+	fail := func(err error) {
+		for _, req := range batch {
+			req.err = err
+		}
+	}
+
+	if len(batch) == 1 {
+		batch[0].results, batch[0].err = b.run(batch[0].ctx, batch[0].feeds)
+		return
+	}
+
+	feeds := make(map[string]*tf.Tensor, len(batch[0].feeds))
+	for key := range batch[0].feeds {
+		tensors := make([]*tf.Tensor, len(batch))
+		for i, req := range batch {
+			tensors[i] = req.feeds[key]
+		}
+		t, err := ConcatTensors(tensors)
+		if err != nil {
+			fail(fmt.Errorf("input %q: %v", key, err))
+			return
+		}
+		feeds[key] = t
+	}
+
+	// The batch outlives the context of any single request.
+	results, err := b.run(context.Background(), feeds)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	sizes := make([]int64, len(batch))
+	var total int64
+	for i, req := range batch {
+		sizes[i] = req.rows
+		total += req.rows
+		req.results = make(map[string]*tf.Tensor, len(results))
+	}
+	for key, t := range results {
+		if shape := t.Shape(); len(shape) == 0 || shape[0] != total {
+			for _, req := range batch {
+				req.results[key] = t
+			}
+			continue
+		}
+		parts, err := SplitTensor(t, sizes)
+		if err != nil {
+			fail(fmt.Errorf("output %q: %v", key, err))
+			return
+		}
+		for i, req := range batch {
+			req.results[key] = parts[i]
+		}
+	}
+}
+
+// batchRows returns the batch size of feeds, the first dimension shared by
+// all of them.
+func batchRows(feeds map[string]*tf.Tensor) (int64, error) {
+	keys := make([]string, 0, len(feeds))
+	for key := range feeds {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	rows := int64(-1)
+	for _, key := range keys {
+		shape := feeds[key].Shape()
+		if len(shape) == 0 {
+			return 0, fmt.Errorf("input %q has no batch dimension", key)
+		}
+		if rows >= 0 && shape[0] != rows {
+			return 0, fmt.Errorf("input %q has batch size %d, expected %d", key, shape[0], rows)
+		}
+		rows = shape[0]
+	}
+	if rows < 0 {
+		return 0, fmt.Errorf("no inputs")
+	}
+	return rows, nil
+}
+
+// stackable reports whether the feeds of two requests can be concatenated.
+func stackable(a, b map[string]*tf.Tensor) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, ta := range a {
+		tb, ok := b[key]
+		if !ok || ta.DataType() != tb.DataType() || !sameShape(ta.Shape()[1:], tb.Shape()[1:]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// CLASSIFICATION OUTPUT
+
+// Classification holds the predictions for an image.
+type Classification struct {
+	Image       string            `json:"image"`
+	Predictions []ClassPrediction `json:"predictions"`
+}
+
+// ClassPrediction is a class and its probability.
+type ClassPrediction struct {
+	Index       int     `json:"index"`
+	Label       string  `json:"label,omitempty"`
+	Probability float32 `json:"probability"`
+}
+
+// Classification labels the predictions for the image at path with labels.
+func (s Predictions) Classification(path string, labels []string) Classification {
+	cl := Classification{Image: path, Predictions: make([]ClassPrediction, s.Len())}
+	for i, index := range s.Indexes {
+		p := ClassPrediction{Index: index, Probability: s.Probabilities[i]}
+		if index < len(labels) {
+			p.Label = labels[index]
+		}
+		cl.Predictions[i] = p
+	}
+	return cl
+}
+
+// WriteClassifications writes results to w as "json", an array of
+// Classification; "csv", a row per prediction with the image and the rank of
+// the prediction; or "text", a line per prediction.
+func WriteClassifications(w io.Writer, format string, results []Classification) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"image", "rank", "index", "label", "probability"})
+		for _, r := range results {
+			for i, p := range r.Predictions {
+				cw.Write([]string{r.Image, strconv.Itoa(i + 1), strconv.Itoa(p.Index), p.Label,
+					strconv.FormatFloat(float64(p.Probability), 'g', -1, 32)})
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case "text":
+		for _, r := range results {
+			for _, p := range r.Predictions {
+				if _, err := fmt.Fprintln(w, r.Image+":", p.Index, p.Label, p.Probability); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
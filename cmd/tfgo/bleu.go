@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rai-project/tensorflow-go-examples/gnmt/bleu"
+)
+
+func runEvalBLEU(args []string) error {
+	fs, common := newFlagSet("eval-bleu", "-")
+	hyp := fs.String("hyp", "", "File of hypotheses, one sentence per line")
+	ref := fs.String("ref", "", "Comma separated reference files aligned with -hyp")
+	lowercase := fs.Bool("lc", false, "Lowercase hypotheses and references")
+	tokenize := fs.String("tokenize", "13a", "Tokenizer: 13a or none for pre-tokenized text")
+	format := fs.String("format", "text", "Output format: text or json")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *hyp == "" || *ref == "" {
+		return usageError("eval-bleu needs -hyp and -ref")
+	}
+	if *format != "text" && *format != "json" {
+		return usageError("unknown format %q", *format)
+	}
+
+	opts := bleu.Options{Lowercase: *lowercase, Tokenize: *tokenize}
+	refs := strings.Split(*ref, ",")
+	score, err := bleu.Files(*hyp, refs, opts)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		return writeJSON(common.out, map[string]interface{}{
+			"score":     score,
+			"signature": opts.Signature(len(refs)),
+		})
+	}
+	out, err := createOutput(common.out)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s\n%s\n", score, opts.Signature(len(refs)))
+	return out.Close()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"path/filepath"
+
+	utils "github.com/rai-project/tensorflow-go-examples"
+	"github.com/rai-project/tensorflow-go-examples/task"
+)
+
+func runClassify(args []string) error {
+	fs, common := newFlagSet(task.Classify, "-")
+	images := addImageFlags(fs, "platypus.jpg")
+	topK := fs.Int("topk", 1, "Number of most probable classes to output")
+	minProb := fs.Float64("min-prob", 0, "Minimum probability of the classes output")
+	format := fs.String("format", "text", "Output format: text, json or csv")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *topK <= 0 {
+		return usageError("-topk must be positive")
+	}
+	if *format != "text" && *format != "json" && *format != "csv" {
+		return usageError("unknown format %q", *format)
+	}
+	batch, err := images.batch()
+	if err != nil {
+		return err
+	}
+
+	manifest, err := common.loadManifest(task.Classify)
+	if err != nil {
+		return err
+	}
+	options, err := common.sessionOptions()
+	if err != nil {
+		return err
+	}
+	classifier, err := task.NewClassifier(manifest, common.dir, options)
+	if err != nil {
+		return modelError(err)
+	}
+	defer classifier.Close()
+	writeProfile := common.startProfile(classifier.Model)
+
+	classify := func(ctx context.Context, path string, img image.Image) (utils.Classification, error) {
+		preds, err := classifier.TopKContext(ctx, img, *topK)
+		if err != nil {
+			return utils.Classification{}, err
+		}
+		return classifier.Classification(path, preds.Above(float32(*minProb))), nil
+	}
+
+	if batch {
+		// The results file holds the classifications in -format and every
+		// image is written with its most probable class.
+		if images.results == "" {
+			ext := map[string]string{"text": ".txt", "json": ".json", "csv": ".csv"}[*format]
+			images.results = filepath.Join(images.outDir, "results"+ext)
+		}
+		job := func(ctx context.Context, in utils.ImageInput, img image.Image, output string) (image.Image, interface{}, error) {
+			cl, err := classify(ctx, in.Path, img)
+			if err != nil {
+				return nil, nil, err
+			}
+			labeled := image.NewRGBA(img.Bounds())
+			draw.Draw(labeled, labeled.Bounds(), img, img.Bounds().Min, draw.Src)
+			if len(cl.Predictions) != 0 {
+				p := cl.Predictions[0]
+				utils.AddLabel(labeled, labeled.Bounds().Min.X, labeled.Bounds().Min.Y+13, 0, fmt.Sprintf("%s (%2.0f%%)", p.Label, p.Probability*100.0))
+			}
+			return labeled, cl, nil
+		}
+		writeResults := func(w io.Writer, records []interface{}) error {
+			results := make([]utils.Classification, len(records))
+			for i, r := range records {
+				results[i] = r.(utils.Classification)
+			}
+			return utils.WriteClassifications(w, *format, results)
+		}
+		if err := images.processImages(classifier.Model, ".jpg", job, writeResults); err != nil {
+			return err
+		}
+		return writeProfile()
+	}
+
+	img, err := utils.OpenImage(images.input)
+	if err != nil {
+		return err
+	}
+	cl, err := classify(context.Background(), images.input, img)
+	if err != nil {
+		return err
+	}
+	if err := writeProfile(); err != nil {
+		return err
+	}
+
+	out, err := createOutput(common.out)
+	if err != nil {
+		return err
+	}
+	if err := utils.WriteClassifications(out, *format, []utils.Classification{cl}); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
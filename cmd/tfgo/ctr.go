@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/rai-project/tensorflow-go-examples/dien/data"
+	"github.com/rai-project/tensorflow-go-examples/task"
+)
+
+func runCTR(args []string) error {
+	fs, common := newFlagSet(task.CTR, "-")
+	dataDir := fs.String("data", ".", "Directory containing the DIEN vocabularies, item-info, reviews-info and local_test_splitByUser")
+	batchSize := fs.Int("batch-size", 16, "Number of samples scored per run")
+	maxLen := fs.Int("maxlen", 0, "Keep the last maxlen items of longer histories, 0 keeps them all")
+	eval := fs.Bool("eval", false, "Score the whole test split and print AUC, loss, accuracy and throughput")
+	format := fs.String("format", "text", "Output format of -eval: text or json")
+	negSamples := fs.Int("neg-samples", data.NegSamples, "No-click items sampled per history item, for models fed no-click histories")
+	seed := fs.Int64("seed", 0, "Seed of the no-click sampling")
+	dump := fs.String("dump", "", "NPZ file the scored batch is written to, to replay it with -replay")
+	replay := fs.String("replay", "", "NPZ file written by -dump, scored instead of a batch of -data")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *batchSize <= 0 {
+		return usageError("-batch-size must be positive")
+	}
+	if *maxLen < 0 {
+		return usageError("-maxlen must not be negative")
+	}
+	if *format != "text" && *format != "json" {
+		return usageError("unknown format %q", *format)
+	}
+	if *negSamples <= 0 {
+		return usageError("-neg-samples must be positive")
+	}
+	if *eval && *replay != "" {
+		return usageError("-eval and -replay are exclusive")
+	}
+
+	manifest, err := common.loadManifest(task.CTR)
+	if err != nil {
+		return err
+	}
+	options, err := common.sessionOptions()
+	if err != nil {
+		return err
+	}
+	scorer, err := task.NewCTRScorer(manifest, common.dir, options)
+	if err != nil {
+		return modelError(err)
+	}
+	defer scorer.Close()
+	writeProfile := common.startProfile(scorer.Model)
+
+	var batch *data.Batch
+	if *replay != "" {
+		if batch, err = data.ReadDump(*replay); err != nil {
+			return err
+		}
+	} else {
+		ds, err := data.Load(data.DefaultPaths(*dataDir))
+		if err != nil {
+			return err
+		}
+		batchOptions := data.BatchOptions{BatchSize: *batchSize, MaxLen: *maxLen}
+		if scorer.TakesNoClk() {
+			batchOptions.NegSamples, batchOptions.Seed = *negSamples, *seed
+		}
+		if *eval {
+			batchOptions.BufferBatches, batchOptions.Epochs = 20, 1
+			return evalCTR(scorer, ds, batchOptions, common.out, *format, writeProfile)
+		}
+		batches, err := data.NewBatches(ds, batchOptions)
+		if err != nil {
+			return err
+		}
+		defer batches.Close()
+		samples, err := batches.Next()
+		if err != nil {
+			return err
+		}
+		batch = data.NewBatch(samples, *maxLen)
+	}
+	if *dump != "" {
+		if err := batch.WriteDump(*dump); err != nil {
+			return err
+		}
+	}
+	result, err := scorer.RunContext(context.Background(), batch)
+	if err != nil {
+		return err
+	}
+	if scorer.HasAuxLoss() {
+		log.Printf("aux_loss: %g", result.AuxLoss)
+	}
+	if err := writeProfile(); err != nil {
+		return err
+	}
+
+	out, err := createOutput(common.out)
+	if err != nil {
+		return err
+	}
+	for _, p := range result.Probabilities {
+		fmt.Fprintln(out, p)
+	}
+	return out.Close()
+}
+
+// evalCTR scores the whole test split once, batched like the AI Matrix test
+// script batches it.
+func evalCTR(scorer *task.CTRScorer, ds *data.Dataset, options data.BatchOptions, path, format string, writeProfile func() error) error {
+	batches, err := data.NewBatches(ds, options)
+	if err != nil {
+		return err
+	}
+	defer batches.Close()
+	e, err := scorer.Evaluate(batches)
+	if err != nil {
+		return err
+	}
+	if err := writeProfile(); err != nil {
+		return err
+	}
+
+	if format == "json" {
+		return writeJSON(path, e)
+	}
+	out, err := createOutput(path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, e.Result)
+	fmt.Fprintf(out, "%d samples in %d batches, %.3fs, %.1f samples/sec\n", e.Samples, e.Batches, e.Seconds, e.SamplesPerSec)
+	return out.Close()
+}
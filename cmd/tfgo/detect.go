@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"os"
+
+	utils "github.com/rai-project/tensorflow-go-examples"
+	"github.com/rai-project/tensorflow-go-examples/task"
+)
+
+func runDetect(args []string) error {
+	return detect(task.Detect, 0.4, args)
+}
+
+func runSegmentInstances(args []string) error {
+	return detect(task.SegmentInstances, 0.9, args)
+}
+
+// detectionRecord is the record of an image in the results file.
+type detectionRecord struct {
+	Image      string           `json:"image"`
+	Output     string           `json:"output"`
+	Detections []task.Detection `json:"detections"`
+}
+
+// detect implements both detect and segment-instances, which only differ in
+// the default model and whether masks are drawn.
+func detect(name string, threshold float64, args []string) error {
+	fs, common := newFlagSet(name, "output.jpg")
+	images := addImageFlags(fs, "lane_control.jpg")
+	fs.Float64Var(&threshold, "threshold", threshold, "Minimum score of the detections to draw")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	batch, err := images.batch()
+	if err != nil {
+		return err
+	}
+
+	manifest, err := common.loadManifest(name)
+	if err != nil {
+		return err
+	}
+	options, err := common.sessionOptions()
+	if err != nil {
+		return err
+	}
+	detector, err := task.NewDetector(manifest, common.dir, float32(threshold), options)
+	if err != nil {
+		return modelError(err)
+	}
+	defer detector.Close()
+	writeProfile := common.startProfile(detector.Model)
+
+	if batch {
+		job := func(ctx context.Context, in utils.ImageInput, img image.Image, output string) (image.Image, interface{}, error) {
+			detections, err := detector.DetectContext(ctx, img)
+			if err != nil {
+				return nil, nil, err
+			}
+			if detections == nil {
+				detections = []task.Detection{}
+			}
+			return task.DrawDetections(img, detections), detectionRecord{Image: in.Path, Output: output, Detections: detections}, nil
+		}
+		if err := images.processImages(detector.Model, ".jpg", job, writeRecords); err != nil {
+			return err
+		}
+		return writeProfile()
+	}
+
+	img, err := utils.OpenImage(images.input)
+	if err != nil {
+		return err
+	}
+	detections, err := detector.Detect(img)
+	if err != nil {
+		return err
+	}
+	if err := writeProfile(); err != nil {
+		return err
+	}
+
+	for _, det := range detections {
+		fmt.Fprintf(os.Stderr, "%d %s %.3f %v\n", det.Class, det.Label, det.Score, det.Box)
+	}
+	return writeImage(common.out, task.DrawDetections(img, detections))
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"image"
+
+	utils "github.com/rai-project/tensorflow-go-examples"
+	"github.com/rai-project/tensorflow-go-examples/task"
+)
+
+func runEnhance(args []string) error {
+	fs, common := newFlagSet(task.Enhance, "output.png")
+	images := addImageFlags(fs, "penguin.png")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	batch, err := images.batch()
+	if err != nil {
+		return err
+	}
+
+	manifest, err := common.loadManifest(task.Enhance)
+	if err != nil {
+		return err
+	}
+	options, err := common.sessionOptions()
+	if err != nil {
+		return err
+	}
+	enhancer, err := task.NewEnhancer(manifest, common.dir, options)
+	if err != nil {
+		return modelError(err)
+	}
+	defer enhancer.Close()
+	writeProfile := common.startProfile(enhancer.Model)
+
+	if batch {
+		job := func(ctx context.Context, in utils.ImageInput, img image.Image, output string) (image.Image, interface{}, error) {
+			enhanced, err := enhancer.EnhanceContext(ctx, img)
+			if err != nil {
+				return nil, nil, err
+			}
+			b := enhanced.Bounds()
+			return enhanced, imageRecord{Image: in.Path, Output: output, Width: b.Dx(), Height: b.Dy()}, nil
+		}
+		if err := images.processImages(enhancer.Model, ".png", job, writeRecords); err != nil {
+			return err
+		}
+		return writeProfile()
+	}
+
+	img, err := utils.OpenImage(images.input)
+	if err != nil {
+		return err
+	}
+	enhanced, err := enhancer.Enhance(img)
+	if err != nil {
+		return err
+	}
+	if err := writeProfile(); err != nil {
+		return err
+	}
+	return writeImage(common.out, enhanced)
+}
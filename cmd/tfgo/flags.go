@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	utils "github.com/rai-project/tensorflow-go-examples"
+	"github.com/rai-project/tensorflow-go-examples/task"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// commonFlags are the flags shared by every command.
+type commonFlags struct {
+	dir      string
+	manifest string
+	labels   string
+	out      string
+	intraOp  int
+	interOp  int
+	profile  string
+}
+
+// newFlagSet returns the flag set of the command name with the common flags
+// registered. out is the default of -out.
+func newFlagSet(name, out string) (*flag.FlagSet, *commonFlags) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	c := &commonFlags{}
+	fs.StringVar(&c.dir, "dir", "", "Directory containing trained model files")
+	fs.StringVar(&c.manifest, "manifest", "", "Path of the model manifest. Defaults to the model.yml of the example, relative to the root of the repository")
+	fs.StringVar(&c.labels, "labels", "", "Path to file of labels, one per line. Defaults to the labels of the manifest")
+	fs.StringVar(&c.out, "out", out, "Path of the output file, - for stdout")
+	fs.IntVar(&c.intraOp, "intra-op-threads", 0, "Threads used within an operation, 0 lets TensorFlow pick")
+	fs.IntVar(&c.interOp, "inter-op-threads", 0, "Threads used across independent operations, 0 lets TensorFlow pick")
+	fs.StringVar(&c.profile, "profile", "", "Trace the model runs, print the time per op and write a Chrome trace to this file")
+	fs.Var(&opLibraries{}, "op-library", "Comma separated shared libraries of custom ops to load before the model, e.g. _beam_search_ops.so. May be repeated")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: tfgo %s [flags]\n\n", name)
+		fs.PrintDefaults()
+	}
+	return fs, c
+}
+
+// parse parses args, turning flag errors into usage errors.
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+		return &exitStatus{exitUsage, err}
+	}
+	if fs.NArg() != 0 {
+		return usageError("unexpected arguments %v", fs.Args())
+	}
+	if f := fs.Lookup("op-library"); f != nil {
+		return f.Value.(*opLibraries).load()
+	}
+	return nil
+}
+
+// opLibraries is the value of -op-library.
+type opLibraries struct {
+	paths []string
+}
+
+func (l *opLibraries) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(l.paths, ",")
+}
+
+func (l *opLibraries) Set(v string) error {
+	for _, path := range strings.Split(v, ",") {
+		if path != "" {
+			l.paths = append(l.paths, path)
+		}
+	}
+	return nil
+}
+
+// load loads the libraries, logging the ops they register.
+func (l *opLibraries) load() error {
+	for _, path := range l.paths {
+		lib, err := utils.LoadOpLibrary(path)
+		if err != nil {
+			return modelError(err)
+		}
+		log.Printf("loaded %s: %s", lib.Path, strings.Join(lib.Ops, ", "))
+	}
+	return nil
+}
+
+// loadManifest reads -manifest, or falls back to the manifest shipped with
+// the example of name, looked up from the working directory. -labels
+// overrides the labels of the manifest.
+func (c *commonFlags) loadManifest(name string) (*utils.Manifest, error) {
+	path := c.manifest
+	if path == "" {
+		example, ok := task.ExampleManifests[name]
+		if !ok {
+			return nil, usageError("%s needs a model manifest, use -manifest", name)
+		}
+		if _, err := os.Stat(example); os.IsNotExist(err) {
+			return nil, usageError("%s not found, run tfgo from the root of the repository or use -manifest", example)
+		}
+		path = example
+	}
+	manifest, err := utils.LoadManifest(path)
+	if err != nil {
+		return nil, modelError(err)
+	}
+	if c.labels != "" {
+		// Relative label paths of the manifest are resolved against its
+		// directory, -labels against the working directory.
+		labels, err := filepath.Abs(c.labels)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Labels = labels
+	}
+	return manifest, nil
+}
+
+// sessionOptions returns the session options selected by the thread flags,
+// nil for the defaults of TensorFlow.
+func (c *commonFlags) sessionOptions() (*tf.SessionOptions, error) {
+	if c.intraOp < 0 || c.interOp < 0 {
+		return nil, usageError("thread counts must not be negative")
+	}
+	if c.intraOp == 0 && c.interOp == 0 {
+		return nil, nil
+	}
+	return utils.NewSessionOptions(c.intraOp, c.interOp)
+}
+
+// startProfile enables profiling of model if -profile is set. The returned
+// function prints the time per op to stderr and writes the Chrome trace.
+func (c *commonFlags) startProfile(model *utils.Model) func() error {
+	if c.profile == "" {
+		return func() error { return nil }
+	}
+	profile := model.EnableProfiling()
+	return func() error {
+		if err := profile.WriteTable(os.Stderr, 20); err != nil {
+			return err
+		}
+		f, err := os.Create(c.profile)
+		if err != nil {
+			return err
+		}
+		if err := profile.WriteChromeTrace(f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+}
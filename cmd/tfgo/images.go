@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	utils "github.com/rai-project/tensorflow-go-examples"
+)
+
+// imageFlags select the images of an image command and where their outputs
+// go. Without -out-dir the command processes the single image of -input and
+// writes -out.
+type imageFlags struct {
+	input     string
+	outDir    string
+	results   string
+	batchSize int
+}
+
+// addImageFlags registers the image flags on fs. input is the default image.
+func addImageFlags(fs *flag.FlagSet, input string) *imageFlags {
+	f := &imageFlags{}
+	fs.StringVar(&f.input, "input", input, "Image, directory of images, glob pattern or file listing one image per line")
+	fs.StringVar(&f.outDir, "out-dir", "", "Directory the output of every image is written to, mirroring the paths of the inputs. Required unless -input is a single image")
+	fs.StringVar(&f.results, "results", "", "Results file of every image processed with -out-dir. Defaults to results.json in -out-dir")
+	fs.IntVar(&f.batchSize, "batch-size", 1, "Number of images run at once with -out-dir")
+	return f
+}
+
+// batch reports whether the images are processed into -out-dir. It fails if
+// -input is not a single image and -out-dir is not set.
+func (f *imageFlags) batch() (bool, error) {
+	if f.batchSize <= 0 {
+		return false, usageError("-batch-size must be positive")
+	}
+	if f.outDir != "" {
+		return true, nil
+	}
+	if fi, err := os.Stat(f.input); err == nil && !fi.IsDir() && utils.IsImagePath(f.input) {
+		return false, nil
+	}
+	return false, usageError("-input %s is not an image, set -out-dir", f.input)
+}
+
+// imageJob processes one image. It returns the image written to the output
+// directory, nil for none, and the record of the image in the results file.
+type imageJob func(ctx context.Context, in utils.ImageInput, img image.Image, output string) (image.Image, interface{}, error)
+
+// resultsWriter writes the records of every image to the results file.
+type resultsWriter func(w io.Writer, records []interface{}) error
+
+// writeRecords writes records as a JSON array.
+func writeRecords(w io.Writer, records []interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
+
+// processImages runs job on every image of -input, -batch-size images at a
+// time, writes the image it returns under -out-dir with the extension ext and
+// the records of every image to the results file, in the order of the
+// inputs. Batches run through the one session of model, stacked by its
+// Batcher when they hold images of the same size.
+//
+// An image that cannot be decoded or processed is reported on stderr and
+// left out of the results, and the other images are processed anyway; the
+// error returned then counts the images that failed.
+func (f *imageFlags) processImages(model *utils.Model, ext string, job imageJob, writeResults resultsWriter) error {
+	inputs, err := utils.ImageInputs(f.input)
+	if err != nil {
+		return err
+	}
+	if f.batchSize > 1 {
+		model.EnableBatching(utils.BatchOptions{MaxBatchSize: f.batchSize, MaxWait: 5 * time.Millisecond})
+	}
+
+	records := make([]interface{}, 0, len(inputs))
+	failed := 0
+	for start := 0; start < len(inputs); start += f.batchSize {
+		end := start + f.batchSize
+		if end > len(inputs) {
+			end = len(inputs)
+		}
+		batch, errs := f.processBatch(inputs[start:end], ext, job)
+		for i, err := range errs {
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				failed++
+				continue
+			}
+			records = append(records, batch[i])
+		}
+	}
+
+	path := f.results
+	if path == "" {
+		path = filepath.Join(f.outDir, "results.json")
+	}
+	out, err := createOutput(path)
+	if err != nil {
+		return err
+	}
+	if err := writeResults(out, records); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d of %d images failed", failed, len(inputs))
+	}
+	return nil
+}
+
+// processBatch decodes the images of inputs, then runs job on the images
+// decoded all at once so that their runs are batched, and writes their
+// outputs. It returns the record and the error of every image.
+func (f *imageFlags) processBatch(inputs []utils.ImageInput, ext string, job imageJob) ([]interface{}, []error) {
+	imgs := make([]image.Image, len(inputs))
+	errs := make([]error, len(inputs))
+	parallel(len(inputs), func(i int) {
+		imgs[i], errs[i] = utils.OpenImage(inputs[i].Path)
+	})
+
+	records := make([]interface{}, len(inputs))
+	parallel(len(inputs), func(i int) {
+		if errs[i] != nil {
+			return
+		}
+		output := filepath.Join(f.outDir, strings.TrimSuffix(inputs[i].Name, filepath.Ext(inputs[i].Name))+ext)
+		var img image.Image
+		img, records[i], errs[i] = job(context.Background(), inputs[i], imgs[i], output)
+		if errs[i] != nil {
+			errs[i] = fmt.Errorf("%s: %v", inputs[i].Path, errs[i])
+			return
+		}
+		if img == nil {
+			return
+		}
+		if errs[i] = os.MkdirAll(filepath.Dir(output), 0755); errs[i] == nil {
+			errs[i] = writeImage(output, img)
+		}
+	})
+	return records, errs
+}
+
+// parallel calls fn(i) for every i below n concurrently and waits for them.
+func parallel(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
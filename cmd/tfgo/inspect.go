@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+
+	utils "github.com/rai-project/tensorflow-go-examples"
+)
+
+func runInspect(args []string) error {
+	fs, common := newFlagSet("inspect", "-")
+	graph := fs.String("graph", "", "Frozen graph file or SavedModel directory. Defaults to the graph of -manifest in -dir")
+	tags := fs.String("tags", "serve", "Comma separated tags of the SavedModel meta graph")
+	format := fs.String("format", "text", "Output format: text or json")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *format != "text" && *format != "json" {
+		return usageError("unknown format %q", *format)
+	}
+
+	path := *graph
+	tagList := strings.Split(*tags, ",")
+	if path == "" {
+		if common.manifest == "" {
+			return usageError("inspect needs -graph or -manifest")
+		}
+		manifest, err := utils.LoadManifest(common.manifest)
+		if err != nil {
+			return modelError(err)
+		}
+		path = manifest.Path(common.dir, manifest.Graph)
+		if len(manifest.Tags) != 0 {
+			tagList = manifest.Tags
+		}
+	}
+
+	info, err := utils.Inspect(path, tagList)
+	if err != nil {
+		return modelError(err)
+	}
+
+	if *format == "json" {
+		return writeJSON(common.out, info)
+	}
+	out, err := createOutput(common.out)
+	if err != nil {
+		return err
+	}
+	if err := info.WriteText(out); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	utils "github.com/rai-project/tensorflow-go-examples"
+	"github.com/rai-project/tensorflow-go-examples/dien/data"
+	"github.com/rai-project/tensorflow-go-examples/loadgen"
+	"github.com/rai-project/tensorflow-go-examples/task"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+func runLoadgen(args []string) error {
+	fs, common := newFlagSet("loadgen", "mlperf_log_summary.txt")
+	taskName := fs.String("task", task.Classify, "Task of the model: classify, detect, segment-instances, segment-semantic, enhance or ctr")
+	scenarioName := fs.String("scenario", string(loadgen.SingleStream), "MLPerf scenario: SingleStream, MultiStream, Server or Offline")
+	input := fs.String("input", "platypus.jpg", "Comma separated images of the sample library of image tasks")
+	dataDir := fs.String("data", ".", "Directory containing the DIEN vocabularies and local_test_splitByUser, for ctr")
+	sampleCount := fs.Int("samples", 1024, "Number of samples read from -data, for ctr")
+	maxLen := fs.Int("maxlen", 100, "Keep the last maxlen items of longer histories, for ctr. 0 keeps them all")
+	samplesPerQuery := fs.Int("samples-per-query", 8, "Samples per MultiStream query")
+	targetQPS := fs.Float64("target-qps", 0, "Arrival rate of Server queries, expected throughput of Offline runs. Offline runs measure it in a warm-up run by default")
+	maxInFlight := fs.Int("max-in-flight", 128, "Maximum number of Server queries running at once")
+	targetLatency := fs.Duration("target-latency", 0, "Latency bound of Server and MultiStream runs, e.g. 15ms")
+	minDuration := fs.Duration("min-duration", 60*time.Second, "Minimum duration of a valid run")
+	minQueries := fs.Int("min-queries", 1024, "Minimum number of queries of a valid run")
+	seed := fs.Int64("seed", 0, "Seed of sample selection and Server arrivals")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	scenario, err := loadgen.ParseScenario(*scenarioName)
+	if err != nil {
+		return usageError("%v", err)
+	}
+	if *maxLen < 0 {
+		return usageError("-maxlen must not be negative")
+	}
+	if *maxInFlight <= 0 {
+		return usageError("-max-in-flight must be positive")
+	}
+
+	manifest, err := common.loadManifest(*taskName)
+	if err != nil {
+		return err
+	}
+	options, err := common.sessionOptions()
+	if err != nil {
+		return err
+	}
+	model, err := manifest.Load(common.dir, options)
+	if err != nil {
+		return modelError(err)
+	}
+	defer model.Close()
+	writeProfile := common.startProfile(model)
+
+	var lib library
+	if *taskName == task.CTR {
+		lib, err = newCTRLibrary(*dataDir, *sampleCount, *maxLen)
+		if err != nil {
+			return err
+		}
+	} else {
+		lib, err = newImageLibrary(manifest, strings.Split(*input, ","))
+		if err != nil {
+			return err
+		}
+	}
+	if lib.size() == 0 {
+		return usageError("the sample library is empty")
+	}
+
+	run := func(ctx context.Context, samples []int) error {
+		return lib.run(ctx, model, samples)
+	}
+	settings := loadgen.Settings{
+		Scenario:        scenario,
+		SampleCount:     lib.size(),
+		SamplesPerQuery: *samplesPerQuery,
+		TargetQPS:       *targetQPS,
+		MaxInFlight:     *maxInFlight,
+		TargetLatency:   *targetLatency,
+		MinDuration:     *minDuration,
+		MinQueryCount:   *minQueries,
+		Seed:            *seed,
+	}
+	result, err := loadgen.Run(context.Background(), run, settings)
+	if err != nil {
+		return err
+	}
+	if err := writeProfile(); err != nil {
+		return err
+	}
+
+	status := "INVALID"
+	if result.Valid() {
+		status = "VALID"
+	}
+	log.Printf("%s: %d queries, %.2f QPS, p50 %v, p90 %v, p99 %v, %s",
+		scenario, result.Queries, result.QPS(),
+		result.Percentile(0.50), result.Percentile(0.90), result.Percentile(0.99), status)
+
+	out, err := createOutput(common.out)
+	if err != nil {
+		return err
+	}
+	if err := result.WriteSummary(out, manifest.Name); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// library is the sample library of a benchmark.
+type library interface {
+	size() int
+	// run runs the model on the samples of one query.
+	run(ctx context.Context, model *utils.Model, samples []int) error
+}
+
+// imageLibrary holds preprocessed images.
+type imageLibrary struct {
+	images []*tf.Tensor
+}
+
+func newImageLibrary(manifest *utils.Manifest, paths []string) (*imageLibrary, error) {
+	dtype := tf.Float
+	if spec, ok := manifest.Input("images"); ok && spec.DType != "" {
+		t, err := utils.ParseDataType(spec.DType)
+		if err != nil {
+			return nil, modelError(err)
+		}
+		dtype = t
+	}
+
+	lib := &imageLibrary{}
+	for _, path := range paths {
+		img, err := utils.OpenImage(path)
+		if err != nil {
+			return nil, err
+		}
+		t, err := manifest.Preprocessing.Tensor(img, dtype)
+		if err != nil {
+			return nil, err
+		}
+		lib.images = append(lib.images, t)
+	}
+	return lib, nil
+}
+
+func (l *imageLibrary) size() int { return len(l.images) }
+
+// run stacks the images of the query into one batch, or runs them one by one
+// if their sizes differ or the model takes a single image.
+func (l *imageLibrary) run(ctx context.Context, model *utils.Model, samples []int) error {
+	tensors := make([]*tf.Tensor, len(samples))
+	for i, s := range samples {
+		tensors[i] = l.images[s]
+	}
+	input, _ := model.Input("images")
+	if shape := input.Shape(); shape.NumDimensions() < 1 || shape.Size(0) != 1 {
+		if batch, err := utils.ConcatTensors(tensors); err == nil {
+			_, err = model.RunContext(ctx, map[string]*tf.Tensor{"images": batch})
+			return err
+		}
+	}
+	for _, t := range tensors {
+		if _, err := model.RunContext(ctx, map[string]*tf.Tensor{"images": t}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ctrLibrary holds DIEN samples, batched and padded per query to their
+// longest history, truncated to maxLen.
+type ctrLibrary struct {
+	samples []data.Sample
+	maxLen  int
+}
+
+func newCTRLibrary(dir string, n, maxLen int) (*ctrLibrary, error) {
+	ds, err := data.Load(data.DefaultPaths(dir))
+	if err != nil {
+		return nil, err
+	}
+	batches, err := data.NewBatches(ds, data.BatchOptions{BatchSize: n, MaxLen: maxLen})
+	if err != nil {
+		return nil, err
+	}
+	defer batches.Close()
+	samples, err := batches.Next()
+	if err != nil {
+		return nil, err
+	}
+	return &ctrLibrary{samples: samples, maxLen: maxLen}, nil
+}
+
+func (l *ctrLibrary) size() int { return len(l.samples) }
+
+func (l *ctrLibrary) run(ctx context.Context, model *utils.Model, samples []int) error {
+	batch := make([]data.Sample, len(samples))
+	for i, s := range samples {
+		batch[i] = l.samples[s]
+	}
+	feeds, err := data.NewBatch(batch, l.maxLen).Tensors()
+	if err != nil {
+		return err
+	}
+	_, err = model.RunContext(ctx, feeds)
+	return err
+}
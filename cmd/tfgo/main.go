@@ -0,0 +1,112 @@
+// Command tfgo runs the TensorFlow Go examples from a single binary.
+//
+// Usage:
+//
+//	tfgo <command> [flags]
+//
+// Every command accepts -dir, -manifest, -labels and -out. The exit code is 0
+// on success, 1 when inference or reading and writing files fails, 2 on bad
+// command lines and 3 when the manifest or the model cannot be loaded.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// Exit codes shared by all commands.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+	exitModel = 3
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"classify", "classify the main object of an image", runClassify},
+		{"detect", "draw boxes around the objects of an image", runDetect},
+		{"segment-instances", "draw boxes and masks around the objects of an image", runSegmentInstances},
+		{"segment-semantic", "color every pixel of an image by its class", runSegmentSemantic},
+		{"enhance", "upscale an image with a super resolution model", runEnhance},
+		{"ctr", "predict click-through rates with DIEN", runCTR},
+		{"translate", "translate sentences with GNMT", runTranslate},
+		{"eval-bleu", "score translations against references with BLEU", runEvalBLEU},
+		{"serve", "serve the models over HTTP", runServe},
+		{"loadgen", "benchmark a model under the MLPerf scenarios", runLoadgen},
+		{"inspect", "list the inputs, outputs and ops of a graph", runInspect},
+		{"run", "run a signature def of a SavedModel on JSON inputs", runSignature},
+	}
+}
+
+// exitStatus is an error carrying the exit code of the command.
+type exitStatus struct {
+	code int
+	err  error
+}
+
+func (e *exitStatus) Error() string { return e.err.Error() }
+
+func usageError(format string, args ...interface{}) error {
+	return &exitStatus{exitUsage, fmt.Errorf(format, args...)}
+}
+
+func modelError(err error) error {
+	return &exitStatus{exitModel, err}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: tfgo <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-18s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'tfgo <command> -h' for the flags of a command.\n")
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("tfgo: ")
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
+	}
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "-help" {
+		usage()
+		os.Exit(exitOK)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		err := cmd.run(os.Args[2:])
+		if err == nil {
+			os.Exit(exitOK)
+		}
+		if err == flag.ErrHelp {
+			os.Exit(exitOK)
+		}
+		if status, ok := err.(*exitStatus); ok {
+			log.Print(status.err)
+			os.Exit(status.code)
+		}
+		log.Print(err)
+		os.Exit(exitError)
+	}
+
+	log.Printf("unknown command %q", name)
+	usage()
+	os.Exit(exitUsage)
+}
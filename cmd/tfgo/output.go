@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// createOutput opens path for writing, or stdout for "" and "-".
+func createOutput(path string) (io.WriteCloser, error) {
+	if path == "" || path == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+	return os.Create(path)
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// writeImage encodes img as PNG or JPEG depending on the extension of path.
+func writeImage(path string, img image.Image) error {
+	out, err := createOutput(path)
+	if err != nil {
+		return err
+	}
+	if strings.ToLower(filepath.Ext(path)) == ".png" {
+		err = png.Encode(out, img)
+	} else {
+		var opt jpeg.Options
+		opt.Quality = 80
+		err = jpeg.Encode(out, img, &opt)
+	}
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// writeJSON writes v as indented JSON to path.
+func writeJSON(path string, v interface{}) error {
+	out, err := createOutput(path)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
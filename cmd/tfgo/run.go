@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	utils "github.com/rai-project/tensorflow-go-examples"
+	"github.com/rai-project/tensorflow-go-examples/server"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+func runSignature(args []string) error {
+	fs, common := newFlagSet("run", "-")
+	graph := fs.String("graph", "", "SavedModel directory. Defaults to the graph of -manifest in -dir")
+	tags := fs.String("tags", "serve", "Comma separated tags of the SavedModel meta graph")
+	signature := fs.String("signature", "", "Signature def to run, e.g. serving_default. Lists the signature defs when empty")
+	inputs := fs.String("inputs", "", "JSON file of an object mapping the signature inputs to nested arrays of values")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	path := *graph
+	tagList := strings.Split(*tags, ",")
+	if path == "" {
+		if common.manifest == "" {
+			return usageError("run needs -graph or -manifest")
+		}
+		manifest, err := utils.LoadManifest(common.manifest)
+		if err != nil {
+			return modelError(err)
+		}
+		path = manifest.Path(common.dir, manifest.Graph)
+		if len(manifest.Tags) != 0 {
+			tagList = manifest.Tags
+		}
+		if *signature == "" {
+			*signature = manifest.Signature
+		}
+	}
+
+	if *signature == "" {
+		sigs, err := utils.ReadSignatures(path, tagList)
+		if err != nil {
+			return modelError(err)
+		}
+		out, err := createOutput(common.out)
+		if err != nil {
+			return err
+		}
+		if err := utils.WriteSignatures(out, sigs); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	}
+	if *inputs == "" {
+		return usageError("run needs a file of input values, use -inputs")
+	}
+	values, err := readInputs(*inputs)
+	if err != nil {
+		return err
+	}
+
+	options, err := common.sessionOptions()
+	if err != nil {
+		return err
+	}
+	model, err := utils.LoadSignature(path, tagList, *signature, options)
+	if err != nil {
+		return modelError(err)
+	}
+	defer model.Close()
+	writeProfile := common.startProfile(model)
+
+	feeds := make(map[string]*tf.Tensor, len(values))
+	for key, v := range values {
+		input, ok := model.Input(key)
+		if !ok {
+			return usageError("signature %q has no input %q, inputs: %s", *signature, key, strings.Join(model.Inputs(), ", "))
+		}
+		t, err := server.DecodeJSONTensor(v, input.DataType())
+		if err != nil {
+			return fmt.Errorf("input %q: %v", key, err)
+		}
+		feeds[key] = t
+	}
+	var missing []string
+	for _, key := range model.Inputs() {
+		if _, ok := feeds[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) != 0 {
+		return usageError("missing signature inputs: %s", strings.Join(missing, ", "))
+	}
+
+	results, err := model.Run(feeds)
+	if err != nil {
+		return err
+	}
+	if err := writeProfile(); err != nil {
+		return err
+	}
+	outputs := make(map[string]interface{}, len(results))
+	for key, t := range results {
+		outputs[key] = server.EncodeJSONTensor(t)
+	}
+	return writeJSON(common.out, outputs)
+}
+
+// readInputs reads a JSON object of input values, keeping numbers exact.
+func readInputs(path string) (map[string]interface{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var values map[string]interface{}
+	dec := json.NewDecoder(f)
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return values, nil
+}
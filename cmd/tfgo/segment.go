@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"image"
+
+	utils "github.com/rai-project/tensorflow-go-examples"
+	"github.com/rai-project/tensorflow-go-examples/task"
+)
+
+// imageRecord is the record of an image in the results file of the commands
+// producing images.
+type imageRecord struct {
+	Image  string `json:"image"`
+	Output string `json:"output"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+func runSegmentSemantic(args []string) error {
+	fs, common := newFlagSet(task.SegmentSemantic, "output.jpg")
+	images := addImageFlags(fs, "lane_control.jpg")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	batch, err := images.batch()
+	if err != nil {
+		return err
+	}
+	if images.batchSize > 1 {
+		// The DeepLab graph takes a single image per run.
+		return usageError("segment-semantic runs one image at a time, -batch-size must be 1")
+	}
+
+	manifest, err := common.loadManifest(task.SegmentSemantic)
+	if err != nil {
+		return err
+	}
+	options, err := common.sessionOptions()
+	if err != nil {
+		return err
+	}
+	segmenter, err := task.NewSemanticSegmenter(manifest, common.dir, options)
+	if err != nil {
+		return modelError(err)
+	}
+	defer segmenter.Close()
+	writeProfile := common.startProfile(segmenter.Model)
+
+	if batch {
+		job := func(ctx context.Context, in utils.ImageInput, img image.Image, output string) (image.Image, interface{}, error) {
+			seg, err := segmenter.SegmentContext(ctx, img)
+			if err != nil {
+				return nil, nil, err
+			}
+			return seg.Overlay(), imageRecord{Image: in.Path, Output: output, Width: seg.Width, Height: seg.Height}, nil
+		}
+		if err := images.processImages(segmenter.Model, ".jpg", job, writeRecords); err != nil {
+			return err
+		}
+		return writeProfile()
+	}
+
+	img, err := utils.OpenImage(images.input)
+	if err != nil {
+		return err
+	}
+	seg, err := segmenter.Segment(img)
+	if err != nil {
+		return err
+	}
+	if err := writeProfile(); err != nil {
+		return err
+	}
+	return writeImage(common.out, seg.Overlay())
+}
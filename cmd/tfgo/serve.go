@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/rai-project/tensorflow-go-examples/server"
+)
+
+func runServe(args []string) error {
+	fs, _ := newFlagSet("serve", "")
+	config := fs.String("config", "server.yml", "Path of the server configuration listing the models to load")
+	addr := fs.String("addr", "", "Address to listen on. Overrides the address of the configuration")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	cfg, err := server.LoadConfig(*config)
+	if err != nil {
+		return usageError("%v", err)
+	}
+	if *addr != "" {
+		cfg.Addr = *addr
+	}
+	if cfg.Addr == "" {
+		cfg.Addr = ":8080"
+	}
+
+	s, err := server.New(cfg)
+	if err != nil {
+		return modelError(err)
+	}
+	defer s.Close()
+
+	return server.ListenAndServe(cfg.Addr, s)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/rai-project/tensorflow-go-examples/gnmt/bleu"
+	"github.com/rai-project/tensorflow-go-examples/gnmt/bpe"
+	"github.com/rai-project/tensorflow-go-examples/task"
+)
+
+func runTranslate(args []string) error {
+	fs, common := newFlagSet(task.Translate, "-")
+	input := fs.String("input", "", "Path of a file of source sentences, one per line")
+	batchSize := fs.Int("batch-size", 32, "Number of sentences translated per run")
+	srcVocab := fs.String("src-vocab", "", "Source vocabulary, one token per line, for models fed token ids")
+	tgtVocab := fs.String("tgt-vocab", "", "Target vocabulary, one token per line, for models returning token ids")
+	beamWidth := fs.Int("beam-width", 0, "Beam width fed to graphs taking one, 0 for the width of the graph")
+	tokenize := fs.Bool("tokenize", true, "Split punctuation off the source words and join it back in the translations")
+	bpeCodes := fs.String("bpe-codes", "", "subword-nmt codes file segmenting the source words, e.g. bpe.32000")
+	bpeVocab := fs.String("bpe-vocab", "", "subword-nmt vocabulary restricting the subwords of -bpe-codes")
+	bpeThreshold := fs.Int("bpe-threshold", 1, "Minimum frequency of the subwords of -bpe-vocab")
+	subword := fs.String("subword-option", "", "Subword segmentation of the translations to undo: bpe or empty for none")
+	ref := fs.String("ref", "", "Comma separated reference translations of -input, scored with BLEU once translated")
+	timeMajor := fs.Bool("time-major", true, "Decoder outputs are [time, batch, beam] as in graphs trained by nmt, rather than [batch, time, beam]")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *input == "" {
+		return usageError("translate needs a file of sentences, use -input")
+	}
+	if *batchSize <= 0 {
+		return usageError("-batch-size must be positive")
+	}
+	if *beamWidth < 0 {
+		return usageError("-beam-width must not be negative")
+	}
+	if *subword != "" && *subword != "bpe" {
+		return usageError("unknown -subword-option %q", *subword)
+	}
+	if *bpeVocab != "" && *bpeCodes == "" {
+		return usageError("-bpe-vocab needs -bpe-codes")
+	}
+
+	manifest, err := common.loadManifest(task.Translate)
+	if err != nil {
+		return err
+	}
+	options, err := common.sessionOptions()
+	if err != nil {
+		return err
+	}
+	translator, err := task.NewTranslator(manifest, common.dir, options)
+	if err != nil {
+		return modelError(err)
+	}
+	defer translator.Close()
+	translator.Tokenize = *tokenize
+	translator.TimeMajor = *timeMajor
+	translator.BeamWidth = *beamWidth
+	translator.JoinSubwords = *subword == "bpe"
+	if *bpeCodes != "" {
+		codes, err := bpe.LoadCodes(*bpeCodes)
+		if err != nil {
+			return err
+		}
+		if *bpeVocab != "" {
+			if codes.Vocab, err = bpe.LoadVocab(*bpeVocab, *bpeThreshold); err != nil {
+				return err
+			}
+		}
+		translator.BPE = codes
+	}
+	if translator.TakesIDs() {
+		if *srcVocab == "" || *tgtVocab == "" {
+			return usageError("the model takes token ids, use -src-vocab and -tgt-vocab")
+		}
+		if err := translator.LoadVocabs(*srcVocab, *tgtVocab); err != nil {
+			return modelError(err)
+		}
+	}
+	writeProfile := common.startProfile(translator.Model)
+
+	sentences, err := readLines(*input)
+	if err != nil {
+		return err
+	}
+	var refs [][]string
+	if *ref != "" {
+		for _, path := range strings.Split(*ref, ",") {
+			lines, err := readLines(path)
+			if err != nil {
+				return err
+			}
+			if len(lines) != len(sentences) {
+				return usageError("%s has %d sentences, %s has %d", path, len(lines), *input, len(sentences))
+			}
+			refs = append(refs, lines)
+		}
+	}
+
+	out, err := createOutput(common.out)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	var hyps []string
+	for start := 0; start < len(sentences); start += *batchSize {
+		end := start + *batchSize
+		if end > len(sentences) {
+			end = len(sentences)
+		}
+		translations, err := translator.Translate(sentences[start:end])
+		if err != nil {
+			out.Close()
+			return err
+		}
+		for _, t := range translations {
+			fmt.Fprintln(w, t)
+		}
+		if refs != nil {
+			hyps = append(hyps, translations...)
+		}
+	}
+	if refs != nil {
+		score, err := bleu.Corpus(hyps, refs, bleu.Options{})
+		if err != nil {
+			out.Close()
+			return err
+		}
+		log.Printf("%s %s", score, bleu.Options{}.Signature(len(refs)))
+	}
+	if err := writeProfile(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// readLines returns the lines of the file at path.
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/ioutil"
+
+	"github.com/disintegration/imaging"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// IMAGE DECODING
+
+// ImageFormats are the formats of the images DecodeImage decodes, as named
+// by ImageFormat. Importing the package registers their decoders with the
+// image package too, so image.Decode and imaging.Open read all of them.
+var ImageFormats = []string{"jpeg", "png", "gif", "bmp", "tiff", "webp"}
+
+// ImageFormat returns the format of the image in b, sniffed from its
+// content rather than trusted from a file extension.
+func ImageFormat(b []byte) (string, error) {
+	_, format, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return "", fmt.Errorf("unsupported image format: %v", err)
+	}
+	return format, nil
+}
+
+// DecodeImage decodes the image in b, in any of the ImageFormats, and
+// returns it as a [1, height, width, 3] uint8 tensor along with the decoded
+// image. GIFs are decoded to their first frame and alpha channels are
+// dropped. JPEG images are decoded by the DecodeJpeg op, so that their pixels
+// are those of the TensorFlow input pipelines the models were trained with,
+// the other formats by the Go decoders.
+func DecodeImage(b []byte) (*tf.Tensor, image.Image, error) {
+	img, format, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode image: %v", err)
+	}
+	if format == "jpeg" {
+		tensor, err := decodeJpeg(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		return tensor, img, nil
+	}
+	tensor, err := ImageTensorUint8(imaging.Clone(img))
+	if err != nil {
+		return nil, nil, err
+	}
+	return tensor, img, nil
+}
+
+// DecodeImageFile is like DecodeImage for the image in the file at path.
+func DecodeImageFile(path string) (*tf.Tensor, image.Image, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	tensor, img, err := DecodeImage(b)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return tensor, img, nil
+}
+
+// OpenImage decodes the image in the file at path, in any of the
+// ImageFormats, without making a tensor of it.
+func OpenImage(path string) (image.Image, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to decode image: %v", path, err)
+	}
+	return img, nil
+}
+
+// decodeJpeg runs the DecodeJpegGraph on the JPEG image in b.
+func decodeJpeg(b []byte) (*tf.Tensor, error) {
+	// DecodeJpeg uses a scalar String-valued tensor as input.
+	tensor, err := tf.NewTensor(string(b))
+	if err != nil {
+		return nil, err
+	}
+	graph, input, output, err := DecodeJpegGraph()
+	if err != nil {
+		return nil, err
+	}
+	session, err := tf.NewSession(graph, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	decoded, err := session.Run(
+		map[tf.Output]*tf.Tensor{input: tensor},
+		[]tf.Output{output},
+		nil)
+	if err != nil {
+		return nil, err
+	}
+	return decoded[0], nil
+}
@@ -0,0 +1,328 @@
+package data
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// HistorySeparator separates the item and category keys of the histories of
+// local_test_splitByUser, the ASCII control character STX.
+const HistorySeparator = "\x02"
+
+// Sample is a record mapped through the vocabularies of the dataset.
+type Sample struct {
+	Label  float32
+	UID    int32
+	MID    int32
+	Cat    int32
+	MIDHis []int32
+	CatHis []int32
+	// NoClkMIDHis and NoClkCatHis hold the items a Sampler drew for every
+	// item of the history, and their categories.
+	NoClkMIDHis [][]int32
+	NoClkCatHis [][]int32
+}
+
+// Sample maps the keys of r to their ids. It fails if the item and category
+// histories differ in length.
+func (ds *Dataset) Sample(r Record) (Sample, error) {
+	s := Sample{
+		Label:  r.Label,
+		UID:    ds.UID.ID(r.UID),
+		MID:    ds.MID.ID(r.MID),
+		Cat:    ds.Cat.ID(r.Cat),
+		MIDHis: history(ds.MID, r.MIDHistory),
+		CatHis: history(ds.Cat, r.CatHistory),
+	}
+	if len(s.MIDHis) != len(s.CatHis) {
+		return Sample{}, fmt.Errorf("%s:%d: %d items but %d categories in the history",
+			ds.Paths.Test, r.Line, len(s.MIDHis), len(s.CatHis))
+	}
+	return s, nil
+}
+
+// history maps the keys of a history field to their ids. Like the AI Matrix
+// data iterator, an empty history is a single unknown key.
+func history(v *Vocab, field string) []int32 {
+	keys := strings.Split(field, HistorySeparator)
+	ids := make([]int32, len(keys))
+	for i, key := range keys {
+		ids[i] = v.ID(key)
+	}
+	return ids
+}
+
+// BatchOptions configure Batches. The zero value of MaxLen and
+// BufferBatches keeps whole histories and the order of the file.
+type BatchOptions struct {
+	BatchSize int `json:"batch_size" yaml:"batch_size"`
+	// MaxLen keeps the last MaxLen items of longer histories.
+	MaxLen int `json:"maxlen,omitempty" yaml:"maxlen,omitempty"`
+	// BufferBatches is the number of batches read ahead and sorted by
+	// history length, so that samples of similar lengths are batched
+	// together and padding is minimal. The AI Matrix scripts read 20.
+	BufferBatches int `json:"buffer_batches,omitempty" yaml:"buffer_batches,omitempty"`
+	// Epochs, if positive, is the number of times the samples are read
+	// through, as when testing a model. Next then returns io.EOF.
+	Epochs int `json:"epochs,omitempty" yaml:"epochs,omitempty"`
+	// NegSamples, if positive, is the number of no-click items sampled for
+	// every item of the histories, for models fed no-click histories. Seed
+	// seeds the sampling.
+	NegSamples int   `json:"neg_samples,omitempty" yaml:"neg_samples,omitempty"`
+	Seed       int64 `json:"seed,omitempty" yaml:"seed,omitempty"`
+}
+
+// Batches reads the samples of a dataset batch by batch, indefinitely unless
+// Epochs is set, like the DataIterator of the AI Matrix scripts.
+type Batches struct {
+	ds      *Dataset
+	it      *Iterator
+	sampler *Sampler
+	options BatchOptions
+	buffer  []Sample
+}
+
+// NewBatches opens the sample file of ds. If options.NegSamples is set, the
+// reviews of ds are loaded to sample no-click histories from.
+func NewBatches(ds *Dataset, options BatchOptions) (*Batches, error) {
+	b := &Batches{ds: ds, options: options}
+	if options.NegSamples > 0 {
+		sampler, err := NewSampler(ds, options.NegSamples, options.Seed)
+		if err != nil {
+			return nil, err
+		}
+		b.sampler = sampler
+	}
+	it, err := NewIterator(ds.Paths.Test, options.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	it.Epochs = options.Epochs
+	b.it = it
+	return b, nil
+}
+
+// Next returns the samples of the next batch. When the buffer is empty, it
+// reads BufferBatches batches and sorts them by history length; batches are
+// then taken from the longest histories down. With Epochs set, Next returns
+// io.EOF once every sample has been returned.
+func (b *Batches) Next() ([]Sample, error) {
+	if len(b.buffer) == 0 {
+		n := b.options.BufferBatches
+		if n < 1 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			records, err := b.it.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range records {
+				s, err := b.ds.Sample(r)
+				if err != nil {
+					return nil, err
+				}
+				if b.sampler != nil {
+					if err := b.sampler.Sample(&s); err != nil {
+						return nil, err
+					}
+				}
+				b.buffer = append(b.buffer, s)
+			}
+		}
+		if b.options.BufferBatches > 1 {
+			sort.SliceStable(b.buffer, func(i, j int) bool {
+				return len(b.buffer[i].MIDHis) < len(b.buffer[j].MIDHis)
+			})
+		} else {
+			reverse(b.buffer)
+		}
+	}
+	if len(b.buffer) == 0 {
+		return nil, io.EOF
+	}
+
+	// Samples are popped from the end of the buffer.
+	n := b.options.BatchSize
+	if n > len(b.buffer) {
+		n = len(b.buffer)
+	}
+	batch := make([]Sample, n)
+	for i := range batch {
+		batch[i] = b.buffer[len(b.buffer)-1-i]
+	}
+	b.buffer = b.buffer[:len(b.buffer)-n]
+	return batch, nil
+}
+
+func reverse(samples []Sample) {
+	for i, j := 0, len(samples)-1; i < j; i, j = i+1, j-1 {
+		samples[i], samples[j] = samples[j], samples[i]
+	}
+}
+
+// MaxLen returns the history length Batches truncates to, 0 for none.
+func (b *Batches) MaxLen() int {
+	return b.options.MaxLen
+}
+
+// Close closes the sample file.
+func (b *Batches) Close() error {
+	return b.it.Close()
+}
+
+// Batch holds the inputs of the DIEN graph for a batch of samples, the
+// histories padded with zeros to the longest one, like prepare_data of the
+// AI Matrix scripts builds them.
+type Batch struct {
+	UID    []int32
+	MID    []int32
+	Cat    []int32
+	MIDHis [][]int32
+	CatHis [][]int32
+	Mask   [][]float32
+	SeqLen []int32
+	Labels []float32
+	// NoClkMIDHis and NoClkCatHis are [batch, history, samples], nil unless
+	// the samples have no-click histories.
+	NoClkMIDHis [][][]int32
+	NoClkCatHis [][][]int32
+}
+
+// NewBatch pads the histories of samples. If maxLen is positive, only the
+// last maxLen items of longer histories are kept.
+func NewBatch(samples []Sample, maxLen int) *Batch {
+	n := len(samples)
+	b := &Batch{
+		UID:    make([]int32, n),
+		MID:    make([]int32, n),
+		Cat:    make([]int32, n),
+		MIDHis: make([][]int32, n),
+		CatHis: make([][]int32, n),
+		Mask:   make([][]float32, n),
+		SeqLen: make([]int32, n),
+		Labels: make([]float32, n),
+	}
+
+	longest := 0
+	for i, s := range samples {
+		l := len(s.MIDHis)
+		if maxLen > 0 && l > maxLen {
+			l = maxLen
+		}
+		b.SeqLen[i] = int32(l)
+		if l > longest {
+			longest = l
+		}
+	}
+
+	for i, s := range samples {
+		b.UID[i], b.MID[i], b.Cat[i], b.Labels[i] = s.UID, s.MID, s.Cat, s.Label
+		l := int(b.SeqLen[i])
+		b.MIDHis[i] = make([]int32, longest)
+		b.CatHis[i] = make([]int32, longest)
+		b.Mask[i] = make([]float32, longest)
+		copy(b.MIDHis[i], s.MIDHis[len(s.MIDHis)-l:])
+		copy(b.CatHis[i], s.CatHis[len(s.CatHis)-l:])
+		for j := 0; j < l; j++ {
+			b.Mask[i][j] = 1
+		}
+	}
+
+	if n > 0 && samples[0].NoClkMIDHis != nil {
+		b.NoClkMIDHis = make([][][]int32, n)
+		b.NoClkCatHis = make([][][]int32, n)
+		for i, s := range samples {
+			b.NoClkMIDHis[i] = padNoClk(s.NoClkMIDHis, int(b.SeqLen[i]), longest)
+			b.NoClkCatHis[i] = padNoClk(s.NoClkCatHis, int(b.SeqLen[i]), longest)
+		}
+	}
+	return b
+}
+
+// padNoClk keeps the last l rows of a no-click history and pads it with
+// rows of zeros to longest rows.
+func padNoClk(his [][]int32, l, longest int) [][]int32 {
+	width := 0
+	if len(his) > 0 {
+		width = len(his[0])
+	}
+	padded := make([][]int32, longest)
+	for j := range padded {
+		padded[j] = make([]int32, width)
+	}
+	for j, row := range his[len(his)-l:] {
+		copy(padded[j], row)
+	}
+	return padded
+}
+
+// Len returns the number of samples of the batch.
+func (b *Batch) Len() int {
+	return len(b.UID)
+}
+
+// Target returns the [click, 1-click] rows of the labels of the batch, the
+// target of the AI Matrix scripts.
+func (b *Batch) Target() [][]float32 {
+	target := make([][]float32, b.Len())
+	for i, label := range b.Labels {
+		target[i] = []float32{label, 1 - label}
+	}
+	return target
+}
+
+// Tensors returns the uid, mid, cat, mid history, cat history, mask and
+// sequence length tensors of the batch keyed by the input keys of the DIEN
+// manifest.
+func (b *Batch) Tensors() (map[string]*tf.Tensor, error) {
+	values := map[string]interface{}{
+		"uid":     b.UID,
+		"mid":     b.MID,
+		"cat":     b.Cat,
+		"mid_his": b.MIDHis,
+		"cat_his": b.CatHis,
+		"mask":    b.Mask,
+		"seq_len": b.SeqLen,
+	}
+	tensors := make(map[string]*tf.Tensor, len(values))
+	for key, v := range values {
+		t, err := tf.NewTensor(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", key, err)
+		}
+		tensors[key] = t
+	}
+	return tensors, nil
+}
+
+// AuxTensors returns the no-click histories of the batch and its target,
+// the inputs of the auxiliary loss and metrics of the DIEN graph, keyed
+// "noclk_mid_his", "noclk_cat_his" and "target". It fails if the samples
+// have no no-click histories.
+func (b *Batch) AuxTensors() (map[string]*tf.Tensor, error) {
+	if b.NoClkMIDHis == nil && b.Len() > 0 {
+		return nil, fmt.Errorf("the batch has no no-click histories, set BatchOptions.NegSamples")
+	}
+	values := map[string]interface{}{
+		"noclk_mid_his": b.NoClkMIDHis,
+		"noclk_cat_his": b.NoClkCatHis,
+		"target":        b.Target(),
+	}
+	tensors := make(map[string]*tf.Tensor, len(values))
+	for key, v := range values {
+		t, err := tf.NewTensor(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", key, err)
+		}
+		tensors[key] = t
+	}
+	return tensors, nil
+}
@@ -0,0 +1,246 @@
+package data
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes files, keyed by name, to a temporary directory and
+// returns it.
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "dien")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// record makes a line of local_test_splitByUser.
+func record(label, uid, mid, cat string, midHis, catHis []string) string {
+	return strings.Join([]string{label, uid, mid, cat,
+		strings.Join(midHis, HistorySeparator), strings.Join(catHis, HistorySeparator)}, "\t") + "\n"
+}
+
+func TestParseRecord(t *testing.T) {
+	r, err := ParseRecord("1\tu1\tm1\tc1\tm2\x02m3\tc2\x02c3\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Record{Label: 1, UID: "u1", MID: "m1", Cat: "c1", MIDHistory: "m2\x02m3", CatHistory: "c2\x02c3"}
+	if r != want {
+		t.Errorf("ParseRecord = %+v, want %+v", r, want)
+	}
+
+	for _, line := range []string{"1\tu1\tm1\tc1\tm2", "x\tu1\tm1\tc1\tm2\tc2"} {
+		if _, err := ParseRecord(line); err == nil {
+			t.Errorf("ParseRecord(%q) succeeded, want an error", line)
+		}
+	}
+}
+
+func TestIterator(t *testing.T) {
+	var lines strings.Builder
+	for _, uid := range []string{"u1", "u2", "u3"} {
+		lines.WriteString(record("0", uid, "m", "c", []string{"m"}, []string{"c"}))
+	}
+	// Blank lines are skipped.
+	lines.WriteString("\n")
+	lines.WriteString(record("1", "u4", "m", "c", []string{"m"}, []string{"c"}))
+	lines.WriteString(record("1", "u5", "m", "c", []string{"m"}, []string{"c"}))
+	dir := writeFiles(t, map[string]string{"test": lines.String()})
+	defer os.RemoveAll(dir)
+
+	uids := func(records []Record) []string {
+		var ids []string
+		for _, r := range records {
+			ids = append(ids, r.UID)
+		}
+		return ids
+	}
+
+	t.Run("epochs", func(t *testing.T) {
+		it, err := NewIterator(filepath.Join(dir, "test"), 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer it.Close()
+		it.Epochs = 1
+
+		want := [][]string{{"u1", "u2"}, {"u3", "u4"}, {"u5"}}
+		for _, w := range want {
+			records, err := it.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := uids(records); !reflect.DeepEqual(got, w) {
+				t.Errorf("Next = %v, want %v", got, w)
+			}
+		}
+		if _, err := it.Next(); err != io.EOF {
+			t.Errorf("Next after the last epoch = %v, want io.EOF", err)
+		}
+	})
+
+	t.Run("wrap around", func(t *testing.T) {
+		it, err := NewIterator(filepath.Join(dir, "test"), 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer it.Close()
+
+		records, err := it.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if records[3].Line != 5 {
+			t.Errorf("line of u4 = %d, want 5", records[3].Line)
+		}
+		records, err = it.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := uids(records), []string{"u5", "u1", "u2", "u3"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Next = %v, want %v", got, want)
+		}
+		if it.Epoch() != 1 {
+			t.Errorf("Epoch = %d, want 1", it.Epoch())
+		}
+	})
+}
+
+func TestIteratorErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"malformed": record("0", "u1", "m", "c", nil, nil) + "0\tu2\n",
+		"empty":     "\n",
+	})
+	defer os.RemoveAll(dir)
+
+	tests := []struct{ file, want string }{
+		{"malformed", "malformed:2: want 6 tab separated fields"},
+		{"empty", "has no records"},
+	}
+	for _, tt := range tests {
+		it, err := NewIterator(filepath.Join(dir, tt.file), 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = it.Next()
+		it.Close()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Next error = %v, want %q", tt.file, err, tt.want)
+		}
+	}
+	if _, err := NewIterator(filepath.Join(dir, "empty"), 0); err == nil {
+		t.Error("NewIterator of batch size 0 succeeded")
+	}
+}
+
+func TestNewBatch(t *testing.T) {
+	samples := []Sample{
+		{Label: 1, UID: 1, MID: 10, Cat: 100, MIDHis: []int32{11, 12, 13}, CatHis: []int32{101, 102, 103},
+			NoClkMIDHis: [][]int32{{21}, {22}, {23}}, NoClkCatHis: [][]int32{{201}, {202}, {203}}},
+		{Label: 0, UID: 2, MID: 20, Cat: 200, MIDHis: []int32{14}, CatHis: []int32{104},
+			NoClkMIDHis: [][]int32{{24}}, NoClkCatHis: [][]int32{{204}}},
+	}
+
+	t.Run("padding", func(t *testing.T) {
+		b := NewBatch(samples, 0)
+		want := &Batch{
+			UID:         []int32{1, 2},
+			MID:         []int32{10, 20},
+			Cat:         []int32{100, 200},
+			MIDHis:      [][]int32{{11, 12, 13}, {14, 0, 0}},
+			CatHis:      [][]int32{{101, 102, 103}, {104, 0, 0}},
+			Mask:        [][]float32{{1, 1, 1}, {1, 0, 0}},
+			SeqLen:      []int32{3, 1},
+			Labels:      []float32{1, 0},
+			NoClkMIDHis: [][][]int32{{{21}, {22}, {23}}, {{24}, {0}, {0}}},
+			NoClkCatHis: [][][]int32{{{201}, {202}, {203}}, {{204}, {0}, {0}}},
+		}
+		if !reflect.DeepEqual(b, want) {
+			t.Errorf("NewBatch = %+v\nwant %+v", b, want)
+		}
+		if got, want := b.Target(), [][]float32{{1, 0}, {0, 1}}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Target = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("maxlen", func(t *testing.T) {
+		// The last items of longer histories are kept.
+		b := NewBatch(samples, 2)
+		if got, want := b.MIDHis, [][]int32{{12, 13}, {14, 0}}; !reflect.DeepEqual(got, want) {
+			t.Errorf("MIDHis = %v, want %v", got, want)
+		}
+		if got, want := b.NoClkMIDHis, [][][]int32{{{22}, {23}}, {{24}, {0}}}; !reflect.DeepEqual(got, want) {
+			t.Errorf("NoClkMIDHis = %v, want %v", got, want)
+		}
+		if got, want := b.SeqLen, []int32{2, 1}; !reflect.DeepEqual(got, want) {
+			t.Errorf("SeqLen = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestBatches(t *testing.T) {
+	var lines strings.Builder
+	// Histories of 1 to 4 items, in that order.
+	his := []string{"m1", "m2", "m3", "m4"}
+	cats := []string{"c1", "c1", "c1", "c1"}
+	for n := 1; n <= 4; n++ {
+		lines.WriteString(record("1", "u1", "m1", "c1", his[:n], cats[:n]))
+	}
+	dir := writeFiles(t, map[string]string{
+		"uid_voc":                "u1,1\n",
+		"mid_voc":                "m1,1\nm2,2\nm3,3\nm4,4\n",
+		"cat_voc":                "c1,1\n",
+		"item-info":              "m1\tc1\nm2\tc1\nm3\tc1\nm4\tc1\n",
+		"local_test_splitByUser": lines.String(),
+	})
+	defer os.RemoveAll(dir)
+	ds, err := Load(DefaultPaths(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lengths := func(options BatchOptions) [][]int {
+		batches, err := NewBatches(ds, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer batches.Close()
+		var got [][]int
+		for {
+			samples, err := batches.Next()
+			if err == io.EOF {
+				return got
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var l []int
+			for _, s := range samples {
+				l = append(l, len(s.MIDHis))
+			}
+			got = append(got, l)
+		}
+	}
+
+	// Without buffering the samples keep the order of the file.
+	if got, want := lengths(BatchOptions{BatchSize: 3, Epochs: 1}), [][]int{{1, 2, 3}, {4}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unbuffered batches of lengths %v, want %v", got, want)
+	}
+	// Buffered samples are batched from the longest histories down.
+	if got, want := lengths(BatchOptions{BatchSize: 2, BufferBatches: 2, Epochs: 1}), [][]int{{4, 3}, {2, 1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("buffered batches of lengths %v, want %v", got, want)
+	}
+}
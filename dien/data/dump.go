@@ -0,0 +1,124 @@
+package data
+
+import (
+	"fmt"
+
+	utils "github.com/rai-project/tensorflow-go-examples"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// DumpVersion is the version of the batch dumps WriteDump writes, stored in
+// their "version" array. Version 1 holds the arrays of Tensors, "labels",
+// and the arrays of AuxTensors for batches with no-click histories.
+const DumpVersion = 1
+
+// WriteDump writes the inputs and labels of the batch to an .npz archive at
+// path, which numpy.load reads as well. Dumping the same batch always makes
+// the same file.
+func (b *Batch) WriteDump(path string) error {
+	tensors, err := b.Tensors()
+	if err != nil {
+		return err
+	}
+	if b.NoClkMIDHis != nil {
+		aux, err := b.AuxTensors()
+		if err != nil {
+			return err
+		}
+		for key, t := range aux {
+			tensors[key] = t
+		}
+	}
+	if tensors["labels"], err = tf.NewTensor(b.Labels); err != nil {
+		return err
+	}
+	if tensors["version"], err = tf.NewTensor(int32(DumpVersion)); err != nil {
+		return err
+	}
+	return utils.WriteNPZ(path, tensors)
+}
+
+// ReadDump reads a batch written by WriteDump. The tensors of the batch are
+// those of the batch dumped.
+func ReadDump(path string) (*Batch, error) {
+	tensors, err := utils.ReadNPZ(path)
+	if err != nil {
+		return nil, err
+	}
+	version, ok := tensors["version"]
+	if !ok {
+		return nil, fmt.Errorf("%s is not a batch dump", path)
+	}
+	if v, ok := version.Value().(int32); !ok || v != DumpVersion {
+		return nil, fmt.Errorf("%s: unsupported dump version %v, want %d", path, version.Value(), DumpVersion)
+	}
+
+	b := &Batch{}
+	values := []struct {
+		key      string
+		v        interface{}
+		optional bool
+	}{
+		{"uid", &b.UID, false},
+		{"mid", &b.MID, false},
+		{"cat", &b.Cat, false},
+		{"mid_his", &b.MIDHis, false},
+		{"cat_his", &b.CatHis, false},
+		{"mask", &b.Mask, false},
+		{"seq_len", &b.SeqLen, false},
+		{"labels", &b.Labels, false},
+		{"noclk_mid_his", &b.NoClkMIDHis, true},
+		{"noclk_cat_his", &b.NoClkCatHis, true},
+	}
+	for _, v := range values {
+		t, ok := tensors[v.key]
+		if !ok {
+			if v.optional {
+				continue
+			}
+			return nil, fmt.Errorf("%s: no %s array", path, v.key)
+		}
+		if err := assign(v.v, t.Value()); err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", path, v.key, err)
+		}
+	}
+	for _, n := range []int{len(b.MID), len(b.Cat), len(b.MIDHis), len(b.CatHis), len(b.Mask), len(b.SeqLen), len(b.Labels)} {
+		if n != b.Len() {
+			return nil, fmt.Errorf("%s: arrays of %d and %d samples", path, b.Len(), n)
+		}
+	}
+	return b, nil
+}
+
+// assign stores value, the value of a tensor, in the field dst points to if
+// their types match.
+func assign(dst, value interface{}) error {
+	switch p := dst.(type) {
+	case *[]int32:
+		if v, ok := value.([]int32); ok {
+			*p = v
+			return nil
+		}
+	case *[]float32:
+		if v, ok := value.([]float32); ok {
+			*p = v
+			return nil
+		}
+	case *[][]int32:
+		if v, ok := value.([][]int32); ok {
+			*p = v
+			return nil
+		}
+	case *[][]float32:
+		if v, ok := value.([][]float32); ok {
+			*p = v
+			return nil
+		}
+	case *[][][]int32:
+		if v, ok := value.([][][]int32); ok {
+			*p = v
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected array of %T", value)
+}
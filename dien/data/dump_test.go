@@ -0,0 +1,79 @@
+package data
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDumpRoundTrip(t *testing.T) {
+	samples := []Sample{
+		{Label: 1, UID: 1, MID: 10, Cat: 100, MIDHis: []int32{11, 12}, CatHis: []int32{101, 102},
+			NoClkMIDHis: [][]int32{{21, 31}, {22, 32}}, NoClkCatHis: [][]int32{{201, 301}, {202, 302}}},
+		{Label: 0, UID: 2, MID: 20, Cat: 200, MIDHis: []int32{14}, CatHis: []int32{104},
+			NoClkMIDHis: [][]int32{{24, 34}}, NoClkCatHis: [][]int32{{204, 304}}},
+	}
+	noClk := NewBatch(samples, 0)
+	for i := range samples {
+		samples[i].NoClkMIDHis, samples[i].NoClkCatHis = nil, nil
+	}
+	clk := NewBatch(samples, 0)
+
+	dir, err := ioutil.TempDir("", "dien")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name  string
+		batch *Batch
+	}{
+		{"clicks", clk},
+		{"no clicks", noClk},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name+".npz")
+		if err := tt.batch.WriteDump(path); err != nil {
+			t.Fatalf("%s: WriteDump: %v", tt.name, err)
+		}
+		b, err := ReadDump(path)
+		if err != nil {
+			t.Fatalf("%s: ReadDump: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(b, tt.batch) {
+			t.Errorf("%s: ReadDump = %+v\nwant %+v", tt.name, b, tt.batch)
+		}
+
+		// Dumping the same batch makes the same file.
+		again := filepath.Join(dir, tt.name+"-again.npz")
+		if err := b.WriteDump(again); err != nil {
+			t.Fatal(err)
+		}
+		b1, _ := ioutil.ReadFile(path)
+		b2, _ := ioutil.ReadFile(again)
+		if string(b1) != string(b2) {
+			t.Errorf("%s: dumps of the same batch differ", tt.name)
+		}
+	}
+}
+
+func TestReadDumpErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dien")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := ReadDump(filepath.Join(dir, "missing.npz")); err == nil {
+		t.Error("ReadDump of a missing file succeeded")
+	}
+	path := filepath.Join(dir, "empty.npz")
+	if err := ioutil.WriteFile(path, []byte("not a zip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadDump(path); err == nil {
+		t.Error("ReadDump of a file that is not an archive succeeded")
+	}
+}
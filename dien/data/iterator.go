@@ -0,0 +1,144 @@
+package data
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Record is a line of local_test_splitByUser: the click label, the user, the
+// target item and its category, and the item and category histories of the
+// user. Keys are not mapped through the vocabularies yet.
+type Record struct {
+	// Line is the line number of the record in its file.
+	Line       int
+	Label      float32
+	UID        string
+	MID        string
+	Cat        string
+	MIDHistory string
+	CatHistory string
+}
+
+// ParseRecord parses a line of local_test_splitByUser, six tab separated
+// fields.
+func ParseRecord(text string) (Record, error) {
+	fields := strings.Split(strings.TrimRight(text, "\r\n"), "\t")
+	if len(fields) != 6 {
+		return Record{}, fmt.Errorf("want 6 tab separated fields, got %d", len(fields))
+	}
+	label, err := strconv.ParseFloat(fields[0], 32)
+	if err != nil {
+		return Record{}, fmt.Errorf("invalid label %q", fields[0])
+	}
+	return Record{
+		Label:      float32(label),
+		UID:        fields[1],
+		MID:        fields[2],
+		Cat:        fields[3],
+		MIDHistory: fields[4],
+		CatHistory: fields[5],
+	}, nil
+}
+
+// Iterator reads the records of a sample file batch by batch. Once the end
+// of the file is reached it starts over, so Next never runs out of records.
+type Iterator struct {
+	// Epochs, if positive, is the number of times the file is read through.
+	// Next then returns a last partial batch and io.EOF after it.
+	Epochs int
+
+	path      string
+	batchSize int
+
+	f       *os.File
+	scanner *bufio.Scanner
+	line    int
+	epoch   int
+}
+
+// NewIterator opens the sample file at path, read batchSize records at a
+// time.
+func NewIterator(path string, batchSize int) (*Iterator, error) {
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("batch size must be positive")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	it := &Iterator{path: path, batchSize: batchSize, f: f}
+	it.reset()
+	return it, nil
+}
+
+func (it *Iterator) reset() {
+	it.scanner = bufio.NewScanner(it.f)
+	// Histories make for long lines.
+	it.scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	it.line = 0
+}
+
+// Epoch returns the number of times the file has been read through.
+func (it *Iterator) Epoch() int {
+	return it.epoch
+}
+
+// Next returns the next batch of records, wrapping around at the end of the
+// file. It fails on the first malformed line, naming it.
+func (it *Iterator) Next() ([]Record, error) {
+	batch := make([]Record, 0, it.batchSize)
+	for len(batch) < it.batchSize {
+		r, err := it.next()
+		if err == io.EOF && len(batch) > 0 {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		batch = append(batch, r)
+	}
+	return batch, nil
+}
+
+func (it *Iterator) next() (Record, error) {
+	rewound := false
+	for {
+		if it.scanner.Scan() {
+			it.line++
+			if strings.TrimSpace(it.scanner.Text()) == "" {
+				continue
+			}
+			r, err := ParseRecord(it.scanner.Text())
+			if err != nil {
+				return Record{}, fmt.Errorf("%s:%d: %v", it.path, it.line, err)
+			}
+			r.Line = it.line
+			return r, nil
+		}
+		if err := it.scanner.Err(); err != nil {
+			return Record{}, fmt.Errorf("%s:%d: %v", it.path, it.line+1, err)
+		}
+		if rewound {
+			return Record{}, fmt.Errorf("%s has no records", it.path)
+		}
+		if it.Epochs > 0 && it.epoch+1 >= it.Epochs {
+			it.epoch = it.Epochs
+			return Record{}, io.EOF
+		}
+		if _, err := it.f.Seek(0, io.SeekStart); err != nil {
+			return Record{}, err
+		}
+		it.reset()
+		it.epoch++
+		rewound = true
+	}
+}
+
+// Close closes the sample file.
+func (it *Iterator) Close() error {
+	return it.f.Close()
+}
@@ -0,0 +1,94 @@
+package data
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+)
+
+// NegSamples is the number of no-click items the AI Matrix scripts sample
+// for every item of a history.
+const NegSamples = 5
+
+// LoadReviews reads the items of reviews-info, the population no-click items
+// are sampled from. Items are drawn as often as they were reviewed.
+func (ds *Dataset) LoadReviews() error {
+	f, err := os.Open(ds.Paths.ReviewsInfo)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var reviewed []int32
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) < 2 {
+			return fmt.Errorf("%s:%d: want uid and mid separated by a tab", ds.Paths.ReviewsInfo, line)
+		}
+		reviewed = append(reviewed, ds.MID.ID(fields[1]))
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %v", ds.Paths.ReviewsInfo, err)
+	}
+	if len(reviewed) == 0 {
+		return fmt.Errorf("%s has no reviews", ds.Paths.ReviewsInfo)
+	}
+	ds.Reviewed = reviewed
+	return nil
+}
+
+// Sampler draws the no-click histories of samples like the DataIterator of
+// the AI Matrix scripts: for every item of a history, n items of
+// reviews-info other than it, and their categories.
+type Sampler struct {
+	ds   *Dataset
+	n    int
+	rand *rand.Rand
+}
+
+// NewSampler returns a Sampler drawing n items per history item with a
+// source seeded with seed. The reviews of ds are loaded if they are not yet.
+func NewSampler(ds *Dataset, n int, seed int64) (*Sampler, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("the number of no-click samples must be positive")
+	}
+	if ds.Reviewed == nil {
+		if err := ds.LoadReviews(); err != nil {
+			return nil, err
+		}
+	}
+	return &Sampler{ds: ds, n: n, rand: rand.New(rand.NewSource(seed))}, nil
+}
+
+// Sample sets the no-click histories of s.
+func (sp *Sampler) Sample(s *Sample) error {
+	reviewed := sp.ds.Reviewed
+	s.NoClkMIDHis = make([][]int32, len(s.MIDHis))
+	s.NoClkCatHis = make([][]int32, len(s.MIDHis))
+	for i, pos := range s.MIDHis {
+		mids := make([]int32, 0, sp.n)
+		cats := make([]int32, 0, sp.n)
+		for tries := 0; len(mids) < sp.n; tries++ {
+			if tries > 100*sp.n {
+				return fmt.Errorf("%s: no item to sample other than %d", sp.ds.Paths.ReviewsInfo, pos)
+			}
+			mid := reviewed[sp.rand.Intn(len(reviewed))]
+			if mid == pos {
+				continue
+			}
+			mids = append(mids, mid)
+			cats = append(cats, sp.ds.ItemCat[mid])
+		}
+		s.NoClkMIDHis[i], s.NoClkCatHis[i] = mids, cats
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package data
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Paths locates the files of the AI Matrix DIEN dataset.
+type Paths struct {
+	// UIDVoc, MIDVoc and CatVoc are the user, item and category
+	// vocabularies, one "key,id" pair per line.
+	UIDVoc string `json:"uid_voc" yaml:"uid_voc"`
+	MIDVoc string `json:"mid_voc" yaml:"mid_voc"`
+	CatVoc string `json:"cat_voc" yaml:"cat_voc"`
+	// ItemInfo maps items to their category, one "mid\tcat" pair per line.
+	ItemInfo string `json:"item_info" yaml:"item_info"`
+	// ReviewsInfo lists the reviews, "uid\tmid\t..." per line.
+	ReviewsInfo string `json:"reviews_info" yaml:"reviews_info"`
+	// Test holds the samples, see Record.
+	Test string `json:"test" yaml:"test"`
+}
+
+// DefaultPaths returns the paths of the files of the dataset in dir, named
+// as the AI Matrix scripts name them.
+func DefaultPaths(dir string) Paths {
+	return Paths{
+		UIDVoc:      filepath.Join(dir, "uid_voc"),
+		MIDVoc:      filepath.Join(dir, "mid_voc"),
+		CatVoc:      filepath.Join(dir, "cat_voc"),
+		ItemInfo:    filepath.Join(dir, "item-info"),
+		ReviewsInfo: filepath.Join(dir, "reviews-info"),
+		Test:        filepath.Join(dir, "local_test_splitByUser"),
+	}
+}
+
+// Vocab maps the keys of users, items or categories to the ids fed to the
+// model. Unknown keys map to 0, like in the AI Matrix data iterator.
+type Vocab struct {
+	ids map[string]int32
+}
+
+// LoadVocab reads a vocabulary file of "key,id" lines. It fails on the
+// first malformed line, naming it.
+func LoadVocab(path string) (*Vocab, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	v := &Vocab{ids: map[string]int32{}}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if text == "" {
+			continue
+		}
+		i := strings.LastIndex(text, ",")
+		if i < 0 {
+			return nil, fmt.Errorf("%s:%d: want key,id, got %q", path, line, text)
+		}
+		id, err := strconv.ParseInt(text[i+1:], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid id %q", path, line, text[i+1:])
+		}
+		v.ids[text[:i]] = int32(id)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return v, nil
+}
+
+// Len returns the number of keys of the vocabulary.
+func (v *Vocab) Len() int {
+	return len(v.ids)
+}
+
+// Lookup returns the id of key and whether key is in the vocabulary.
+func (v *Vocab) Lookup(key string) (int32, bool) {
+	id, ok := v.ids[key]
+	return id, ok
+}
+
+// ID returns the id of key, 0 if key is unknown.
+func (v *Vocab) ID(key string) int32 {
+	return v.ids[key]
+}
+
+// Dataset holds the vocabularies of the dataset and the category of every
+// item.
+type Dataset struct {
+	Paths Paths
+	UID   *Vocab
+	MID   *Vocab
+	Cat   *Vocab
+	// ItemCat maps the id of every item of item-info to the id of its
+	// category.
+	ItemCat map[int32]int32
+	// Reviewed holds the item of every line of reviews-info once
+	// LoadReviews has read it.
+	Reviewed []int32
+}
+
+// Load reads the vocabularies and item-info of paths. Reviews are only read
+// by LoadReviews, for sampling no-click histories.
+func Load(paths Paths) (*Dataset, error) {
+	ds := &Dataset{Paths: paths}
+	var err error
+	if ds.UID, err = LoadVocab(paths.UIDVoc); err != nil {
+		return nil, err
+	}
+	if ds.MID, err = LoadVocab(paths.MIDVoc); err != nil {
+		return nil, err
+	}
+	if ds.Cat, err = LoadVocab(paths.CatVoc); err != nil {
+		return nil, err
+	}
+	if ds.ItemCat, err = loadItemInfo(paths.ItemInfo, ds.MID, ds.Cat); err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+// loadItemInfo maps the ids of the items of item-info to the ids of their
+// categories. The first category of an item wins.
+func loadItemInfo(path string, mid, cat *Vocab) (map[int32]int32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	seen := map[string]bool{}
+	itemCat := map[int32]int32{}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: want mid and cat separated by a tab", path, line)
+		}
+		if seen[fields[0]] {
+			continue
+		}
+		seen[fields[0]] = true
+		itemCat[mid.ID(fields[0])] = cat.ID(fields[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return itemCat, nil
+}
@@ -0,0 +1,145 @@
+// Package metrics computes the test metrics of the AI Matrix DIEN scripts:
+// the AUC of the click probabilities, and the loss, including the auxiliary
+// loss of models trained with negative sampling, and accuracy of the softmax
+// output averaged over batches.
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Epsilon is added to the probabilities before taking their log, like the
+// DIEN graph does.
+const Epsilon = 1e-8
+
+// Result holds the metrics of a test run. Loss includes AuxLoss, the mean
+// auxiliary loss, if the model has one.
+type Result struct {
+	AUC        float64 `json:"auc"`
+	Loss       float64 `json:"loss"`
+	Accuracy   float64 `json:"accuracy"`
+	AuxLoss    float64 `json:"aux_loss,omitempty"`
+	HasAuxLoss bool    `json:"-"`
+	Samples    int     `json:"samples"`
+	Batches    int     `json:"batches"`
+}
+
+// String formats r like the AI Matrix test script prints its metrics.
+func (r Result) String() string {
+	s := fmt.Sprintf("test_auc: %.4f ---- test_loss: %.4f ---- test_accuracy: %.4f", r.AUC, r.Loss, r.Accuracy)
+	if r.HasAuxLoss {
+		s += fmt.Sprintf(" ---- test_aux_loss: %.4f", r.AuxLoss)
+	}
+	return s
+}
+
+// Accumulator collects the softmax outputs and targets of the batches of a
+// test run. The zero value is ready to use.
+type Accumulator struct {
+	loss     float64
+	auxLoss  float64
+	hasAux   bool
+	accuracy float64
+	batches  int
+	scores   []float32
+	labels   []float32
+}
+
+// Add adds a batch of softmax outputs and their [click, 1-click] targets.
+// Like the ctr_loss and accuracy nodes of the DIEN graph, the loss and
+// accuracy of the batch are means over every element of the outputs.
+func (a *Accumulator) Add(probs, target [][]float32) error {
+	if len(probs) != len(target) {
+		return fmt.Errorf("%d outputs for %d targets", len(probs), len(target))
+	}
+	if len(probs) == 0 {
+		return nil
+	}
+	var loss, correct float64
+	n := 0
+	for i, p := range probs {
+		if len(p) != len(target[i]) {
+			return fmt.Errorf("output %d has %d columns, want %d", i, len(p), len(target[i]))
+		}
+		for j, v := range p {
+			t := float64(target[i][j])
+			loss -= math.Log(float64(v)+Epsilon) * t
+			if math.RoundToEven(float64(v)+Epsilon) == t {
+				correct++
+			}
+			n++
+		}
+		a.scores = append(a.scores, p[0])
+		a.labels = append(a.labels, target[i][0])
+	}
+	a.loss += loss / float64(n)
+	a.accuracy += correct / float64(n)
+	a.batches++
+	return nil
+}
+
+// AddAuxLoss adds the auxiliary loss of the last batch added. Like the loss
+// node of the DIEN graphs trained with negative sampling, the loss of the
+// batch is then the sum of its ctr loss and its auxiliary loss.
+func (a *Accumulator) AddAuxLoss(loss float64) {
+	a.loss += loss
+	a.auxLoss += loss
+	a.hasAux = true
+}
+
+// Result returns the AUC of the samples added so far and the mean loss,
+// auxiliary loss and accuracy of their batches.
+func (a *Accumulator) Result() Result {
+	r := Result{Samples: len(a.scores), Batches: a.batches, HasAuxLoss: a.hasAux}
+	if a.batches == 0 {
+		return r
+	}
+	r.AUC = AUC(a.scores, a.labels)
+	r.Loss = a.loss / float64(a.batches)
+	r.AuxLoss = a.auxLoss / float64(a.batches)
+	r.Accuracy = a.accuracy / float64(a.batches)
+	return r
+}
+
+// AUC returns the area under the ROC curve of the click probabilities
+// scores of samples labelled 1 for clicks, computed like calc_auc of the AI
+// Matrix scripts: samples of equal scores keep their order rather than
+// being averaged.
+func AUC(scores, labels []float32) float64 {
+	order := make([]int, len(scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+
+	var pos, neg float64
+	for _, label := range labels {
+		if label == 1 {
+			pos++
+		} else {
+			neg++
+		}
+	}
+	if pos == 0 || neg == 0 {
+		return 0
+	}
+
+	var auc, tp, fp, prevX, prevY float64
+	for _, i := range order {
+		if labels[i] == 1 {
+			tp++
+		} else {
+			fp++
+		}
+		x, y := fp/neg, tp/pos
+		if x != prevX {
+			auc += (x - prevX) * (y + prevY) / 2
+			prevX, prevY = x, y
+		}
+	}
+	return auc
+}
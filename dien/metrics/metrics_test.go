@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+)
+
+// The expected AUCs are those of calc_auc of the AI Matrix scripts, quirks
+// included: the previous point only moves when the false positive rate does,
+// so a perfect ranking scores 0.75 on four samples.
+func TestAUC(t *testing.T) {
+	tests := []struct {
+		name   string
+		scores []float32
+		labels []float32
+		want   float64
+	}{
+		{"ranked", []float32{0.9, 0.8, 0.3, 0.1}, []float32{1, 1, 0, 0}, 0.75},
+		{"reversed", []float32{0.1, 0.3, 0.8, 0.9}, []float32{1, 1, 0, 0}, 0},
+		{"alternating", []float32{0.9, 0.8, 0.7, 0.6, 0.5}, []float32{1, 0, 1, 0, 1}, 1.0 / 3},
+		{"unsorted", []float32{0.2, 0.9, 0.4, 0.6, 0.7, 0.1}, []float32{0, 1, 1, 0, 1, 0}, 0.7222222222222222},
+		// Equal scores keep their order.
+		{"tie click first", []float32{0.5, 0.5}, []float32{1, 0}, 0.5},
+		{"tie click last", []float32{0.5, 0.5}, []float32{0, 1}, 0},
+		{"no clicks", []float32{0.5, 0.4}, []float32{0, 0}, 0},
+		{"empty", nil, nil, 0},
+	}
+	for _, tt := range tests {
+		if got := AUC(tt.scores, tt.labels); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("%s: AUC = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAccumulator(t *testing.T) {
+	var acc Accumulator
+	if r := acc.Result(); r != (Result{}) {
+		t.Errorf("Result of no batches = %+v, want zero", r)
+	}
+
+	batches := []struct{ probs, target [][]float32 }{
+		{[][]float32{{0.9, 0.1}, {0.2, 0.8}}, [][]float32{{1, 0}, {0, 1}}},
+		{[][]float32{{0.4, 0.6}}, [][]float32{{1, 0}}},
+	}
+	for _, b := range batches {
+		if err := acc.Add(b.probs, b.target); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := acc.Result()
+	// The loss of a batch is the mean of -log(p+eps)*t over its elements.
+	wantLoss := 0.27013568213865446
+	if math.Abs(r.Loss-wantLoss) > 1e-6 {
+		t.Errorf("Loss = %v, want %v", r.Loss, wantLoss)
+	}
+	if r.Accuracy != 0.5 {
+		t.Errorf("Accuracy = %v, want 0.5", r.Accuracy)
+	}
+	if r.AUC != 0.5 {
+		t.Errorf("AUC = %v, want 0.5", r.AUC)
+	}
+	if r.Samples != 3 || r.Batches != 2 {
+		t.Errorf("Samples, Batches = %d, %d, want 3, 2", r.Samples, r.Batches)
+	}
+}
+
+func TestAccumulatorAuxLoss(t *testing.T) {
+	var acc Accumulator
+	batches := []struct {
+		probs, target [][]float32
+		aux           float64
+	}{
+		{[][]float32{{0.9, 0.1}, {0.2, 0.8}}, [][]float32{{1, 0}, {0, 1}}, 0.1},
+		{[][]float32{{0.4, 0.6}}, [][]float32{{1, 0}}, 0.3},
+	}
+	for _, b := range batches {
+		if err := acc.Add(b.probs, b.target); err != nil {
+			t.Fatal(err)
+		}
+		acc.AddAuxLoss(b.aux)
+	}
+	r := acc.Result()
+	// The loss of DIEN graphs trained with negative sampling adds the
+	// auxiliary loss to the ctr loss.
+	if want := 0.27013568213865446 + 0.2; math.Abs(r.Loss-want) > 1e-6 {
+		t.Errorf("Loss = %v, want %v", r.Loss, want)
+	}
+	if math.Abs(r.AuxLoss-0.2) > 1e-12 || !r.HasAuxLoss {
+		t.Errorf("AuxLoss, HasAuxLoss = %v, %v, want 0.2, true", r.AuxLoss, r.HasAuxLoss)
+	}
+}
+
+func TestAccumulatorErrors(t *testing.T) {
+	var acc Accumulator
+	if err := acc.Add([][]float32{{0.5, 0.5}}, nil); err == nil {
+		t.Error("Add of more outputs than targets succeeded")
+	}
+	if err := acc.Add([][]float32{{1}}, [][]float32{{1, 0}}); err == nil {
+		t.Error("Add of an output narrower than its target succeeded")
+	}
+	if r := acc.Result(); r.Batches != 0 {
+		t.Errorf("failed Adds were counted: %+v", r)
+	}
+}
+
+func TestResultString(t *testing.T) {
+	tests := []struct {
+		r    Result
+		want string
+	}{
+		{Result{AUC: 0.63, Loss: 0.5, Accuracy: 0.71234},
+			"test_auc: 0.6300 ---- test_loss: 0.5000 ---- test_accuracy: 0.7123"},
+		{Result{AUC: 0.63, Loss: 0.5, Accuracy: 0.71234, AuxLoss: 0.125, HasAuxLoss: true},
+			"test_auc: 0.6300 ---- test_loss: 0.5000 ---- test_accuracy: 0.7123 ---- test_aux_loss: 0.1250"},
+	}
+	for _, tt := range tests {
+		if got := tt.r.String(); got != tt.want {
+			t.Errorf("String = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+// Package bleu computes corpus BLEU scores the way sacreBLEU does with its
+// default settings: 13a tokenization, n-grams up to 4, exponential smoothing
+// and the brevity penalty of the closest reference length.
+package bleu
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// MaxOrder is the length of the longest n-grams counted.
+const MaxOrder = 4
+
+// Options select how sentences are preprocessed. The zero value matches the
+// defaults of sacreBLEU.
+type Options struct {
+	Lowercase bool
+	// Tokenize is "13a", the default, or "none" for pre-tokenized text.
+	Tokenize string
+}
+
+func (o Options) tokenizer() (func(string) string, error) {
+	switch o.Tokenize {
+	case "", "13a":
+		return Tokenize13a, nil
+	case "none":
+		return strings.TrimSpace, nil
+	}
+	return nil, fmt.Errorf("unknown tokenizer %q", o.Tokenize)
+}
+
+// Signature describes the settings like the signature of sacreBLEU does.
+func (o Options) Signature(refs int) string {
+	tok := o.Tokenize
+	if tok == "" {
+		tok = "13a"
+	}
+	c := "mixed"
+	if o.Lowercase {
+		c = "lc"
+	}
+	return fmt.Sprintf("nrefs:%d|case:%s|eff:no|tok:%s|smooth:exp", refs, c, tok)
+}
+
+// Score is a corpus BLEU score and the statistics it is computed from.
+// Scores and precisions are percentages.
+type Score struct {
+	BLEU       float64           `json:"bleu"`
+	Precisions [MaxOrder]float64 `json:"precisions"`
+	Correct    [MaxOrder]int     `json:"correct"`
+	Total      [MaxOrder]int     `json:"total"`
+	BP         float64           `json:"bp"`
+	HypLen     int               `json:"hyp_len"`
+	RefLen     int               `json:"ref_len"`
+}
+
+// Ratio returns the ratio of the hypothesis length to the reference length.
+func (s *Score) Ratio() float64 {
+	if s.RefLen == 0 {
+		return 0
+	}
+	return float64(s.HypLen) / float64(s.RefLen)
+}
+
+// String formats s like sacreBLEU, e.g.
+// "BLEU = 24.12 55.1/30.0/18.4/11.9 (BP = 1.000 ratio = 1.023 hyp_len = 62456 ref_len = 61041)".
+func (s *Score) String() string {
+	p := make([]string, MaxOrder)
+	for i, v := range s.Precisions {
+		p[i] = fmt.Sprintf("%.1f", v)
+	}
+	return fmt.Sprintf("BLEU = %.2f %s (BP = %.3f ratio = %.3f hyp_len = %d ref_len = %d)",
+		s.BLEU, strings.Join(p, "/"), s.BP, s.Ratio(), s.HypLen, s.RefLen)
+}
+
+// The rules of the 13a tokenizer of mteval-v13a.pl, in order.
+var rules13a = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`([\{-\~\[-\` + "`" + ` -\&\(-\+\:-\@\/])`), " $1 "},
+	// Periods and commas are split unless preceded by a digit,
+	{regexp.MustCompile(`([^0-9])([\.,])`), "$1 $2 "},
+	// or followed by one.
+	{regexp.MustCompile(`([\.,])([^0-9])`), " $1 $2"},
+	{regexp.MustCompile(`([0-9])(-)`), "$1 $2 "},
+}
+
+// Tokenize13a tokenizes line like the 13a tokenizer of sacreBLEU, the
+// tokenizer of the mteval-v13a.pl script of WMT.
+func Tokenize13a(line string) string {
+	line = strings.Replace(line, "<skipped>", "", -1)
+	line = strings.Replace(line, "-\n", "", -1)
+	line = strings.Replace(line, "\n", " ", -1)
+	if strings.Contains(line, "&") {
+		line = strings.Replace(line, "&quot;", `"`, -1)
+		line = strings.Replace(line, "&amp;", "&", -1)
+		line = strings.Replace(line, "&lt;", "<", -1)
+		line = strings.Replace(line, "&gt;", ">", -1)
+	}
+	line = " " + line + " "
+	for _, r := range rules13a {
+		line = r.re.ReplaceAllString(line, r.repl)
+	}
+	return strings.Join(strings.Fields(line), " ")
+}
+
+// ngrams counts the n-grams of words up to MaxOrder.
+func ngrams(words []string) map[string]int {
+	counts := map[string]int{}
+	for n := 1; n <= MaxOrder; n++ {
+		for i := 0; i+n <= len(words); i++ {
+			counts[strings.Join(words[i:i+n], " ")]++
+		}
+	}
+	return counts
+}
+
+// Corpus scores the hypotheses hyps against one or more reference streams,
+// refs[r][i] being reference r of hyps[i].
+func Corpus(hyps []string, refs [][]string, opts Options) (*Score, error) {
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("no references")
+	}
+	for r, ref := range refs {
+		if len(ref) != len(hyps) {
+			return nil, fmt.Errorf("reference %d has %d sentences, want %d", r+1, len(ref), len(hyps))
+		}
+	}
+	tokenize, err := opts.tokenizer()
+	if err != nil {
+		return nil, err
+	}
+	words := func(s string) []string {
+		if opts.Lowercase {
+			s = strings.ToLower(s)
+		}
+		return strings.Fields(tokenize(s))
+	}
+
+	s := &Score{}
+	for i, hyp := range hyps {
+		hypWords := words(hyp)
+		s.HypLen += len(hypWords)
+
+		// Clip the counts by their maximum in any reference and take the
+		// length of the closest reference, the shorter one on ties.
+		maxRef := map[string]int{}
+		refLen := -1
+		for _, ref := range refs {
+			refWords := words(ref[i])
+			d, best := abs(len(refWords)-len(hypWords)), abs(refLen-len(hypWords))
+			if refLen < 0 || d < best || d == best && len(refWords) < refLen {
+				refLen = len(refWords)
+			}
+			for ngram, c := range ngrams(refWords) {
+				if c > maxRef[ngram] {
+					maxRef[ngram] = c
+				}
+			}
+		}
+		s.RefLen += refLen
+
+		for ngram, c := range ngrams(hypWords) {
+			n := strings.Count(ngram, " ")
+			if m := maxRef[ngram]; m < c {
+				c = m
+			}
+			s.Correct[n] += c
+		}
+		for n := 0; n < MaxOrder; n++ {
+			if k := len(hypWords) - n; k > 0 {
+				s.Total[n] += k
+			}
+		}
+	}
+	s.compute()
+	return s, nil
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// compute derives the precisions, brevity penalty and score from the counts.
+func (s *Score) compute() {
+	smooth := 1.0
+	logSum := 0.0
+	for n := 0; n < MaxOrder; n++ {
+		if s.Total[n] == 0 {
+			break
+		}
+		if s.Correct[n] == 0 {
+			smooth *= 2
+			s.Precisions[n] = 100 / (smooth * float64(s.Total[n]))
+		} else {
+			s.Precisions[n] = 100 * float64(s.Correct[n]) / float64(s.Total[n])
+		}
+	}
+	for _, p := range s.Precisions {
+		if p == 0 {
+			// sacreBLEU takes the log of 0 as -9999999999.
+			logSum += -9999999999
+		} else {
+			logSum += math.Log(p)
+		}
+	}
+
+	s.BP = 1
+	if s.HypLen < s.RefLen {
+		s.BP = 0
+		if s.HypLen > 0 {
+			s.BP = math.Exp(1 - float64(s.RefLen)/float64(s.HypLen))
+		}
+	}
+	s.BLEU = s.BP * math.Exp(logSum/MaxOrder)
+}
+
+// Files scores the hypotheses of the file hyp, one sentence per line,
+// against the reference files refs.
+func Files(hyp string, refs []string, opts Options) (*Score, error) {
+	hyps, err := readLines(hyp)
+	if err != nil {
+		return nil, err
+	}
+	refLines := make([][]string, len(refs))
+	for i, ref := range refs {
+		if refLines[i], err = readLines(ref); err != nil {
+			return nil, err
+		}
+	}
+	return Corpus(hyps, refLines, opts)
+}
+
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return lines, nil
+}
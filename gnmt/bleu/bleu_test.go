@@ -0,0 +1,124 @@
+package bleu
+
+import (
+	"testing"
+)
+
+// The expected scores are those of sacreBLEU with its default settings.
+
+func TestCorpus(t *testing.T) {
+	tests := []struct {
+		name string
+		hyps []string
+		refs [][]string
+		opts Options
+		want string
+	}{
+		{
+			// The example of the sacreBLEU README.
+			name: "two references",
+			hyps: []string{"The dog bit the man.", "It wasn't surprising.", "The man had just bitten him."},
+			refs: [][]string{
+				{"The dog bit the man.", "It was not unexpected.", "The man bit him first."},
+				{"The dog had bit the man.", "No one was surprised.", "The man had bitten the dog."},
+			},
+			want: "BLEU = 48.53 82.4/50.0/45.5/37.5 (BP = 0.943 ratio = 0.944 hyp_len = 17 ref_len = 18)",
+		},
+		{
+			name: "identical",
+			hyps: []string{"the cat sat on the mat"},
+			refs: [][]string{{"the cat sat on the mat"}},
+			want: "BLEU = 100.00 100.0/100.0/100.0/100.0 (BP = 1.000 ratio = 1.000 hyp_len = 6 ref_len = 6)",
+		},
+		{
+			// No 4-gram matches: the precision is smoothed to 100/(2*2).
+			name: "exp smoothing",
+			hyps: []string{"a b c d e"},
+			refs: [][]string{{"a b c x e"}},
+			want: "BLEU = 42.73 80.0/50.0/33.3/25.0 (BP = 1.000 ratio = 1.000 hyp_len = 5 ref_len = 5)",
+		},
+		{
+			// No 3-grams at all: their precision is 0 and so is the score.
+			name: "short hypothesis",
+			hyps: []string{"the cat"},
+			refs: [][]string{{"the cat sat on the mat"}},
+			want: "BLEU = 0.00 100.0/100.0/0.0/0.0 (BP = 0.135 ratio = 0.333 hyp_len = 2 ref_len = 6)",
+		},
+		{
+			name: "empty hypothesis",
+			hyps: []string{""},
+			refs: [][]string{{"the cat sat"}},
+			want: "BLEU = 0.00 0.0/0.0/0.0/0.0 (BP = 0.000 ratio = 0.000 hyp_len = 0 ref_len = 3)",
+		},
+		{
+			name: "lowercase",
+			hyps: []string{"The Cat Sat On The Mat."},
+			refs: [][]string{{"the cat sat on the mat."}},
+			opts: Options{Lowercase: true},
+			want: "BLEU = 100.00 100.0/100.0/100.0/100.0 (BP = 1.000 ratio = 1.000 hyp_len = 7 ref_len = 7)",
+		},
+		{
+			// Without tokenization "mat." does not match "mat".
+			name: "no tokenization",
+			hyps: []string{"the cat sat on the mat."},
+			refs: [][]string{{"the cat sat on the mat"}},
+			opts: Options{Tokenize: "none"},
+			want: "BLEU = 75.98 83.3/80.0/75.0/66.7 (BP = 1.000 ratio = 1.000 hyp_len = 6 ref_len = 6)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Corpus(tt.hyps, tt.refs, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.String(); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCorpusErrors(t *testing.T) {
+	hyps := []string{"a", "b"}
+	tests := []struct {
+		name string
+		refs [][]string
+		opts Options
+	}{
+		{"no references", nil, Options{}},
+		{"missing sentences", [][]string{{"a"}}, Options{}},
+		{"unknown tokenizer", [][]string{{"a", "b"}}, Options{Tokenize: "intl"}},
+	}
+	for _, tt := range tests {
+		if _, err := Corpus(hyps, tt.refs, tt.opts); err == nil {
+			t.Errorf("%s: Corpus succeeded, want an error", tt.name)
+		}
+	}
+}
+
+func TestTokenize13a(t *testing.T) {
+	tests := []struct{ in, want string }{
+		// Apostrophes are not split.
+		{"It wasn't surprising.", "It wasn't surprising ."},
+		{"Hello, world! (really)", "Hello , world ! ( really )"},
+		{"3.14 and 1,000-fold", "3.14 and 1,000 - fold"},
+		{"e-mail x-ray", "e-mail x-ray"},
+		{"&quot;quoted&quot; &amp; &lt;tag&gt;", `" quoted " & < tag >`},
+		{"  spaced   out  ", "spaced out"},
+	}
+	for _, tt := range tests {
+		if got := Tokenize13a(tt.in); got != tt.want {
+			t.Errorf("Tokenize13a(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSignature(t *testing.T) {
+	if got, want := (Options{}).Signature(1), "nrefs:1|case:mixed|eff:no|tok:13a|smooth:exp"; got != want {
+		t.Errorf("Signature = %q, want %q", got, want)
+	}
+	if got, want := (Options{Lowercase: true, Tokenize: "none"}).Signature(2), "nrefs:2|case:lc|eff:no|tok:none|smooth:exp"; got != want {
+		t.Errorf("Signature = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,314 @@
+// Package bpe segments words into subwords with byte pair encoding, as the
+// apply_bpe.py script of subword-nmt does, and joins the subwords back. The
+// GNMT models of MLPerf are trained on BPE segmented text.
+package bpe
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Separator ends every subword that is not the end of a word.
+const Separator = "@@"
+
+// endOfWord marks the last symbol of a word in the merge operations.
+const endOfWord = "</w>"
+
+type pair struct{ left, right string }
+
+// BPE applies the merge operations of a codes file. It is safe for concurrent
+// use once Vocab and UNK are set: segmentations are cached.
+type BPE struct {
+	// Version of the codes file: 1 for 0.1, 2 for 0.2.
+	Version int
+	// Vocab, if set, restricts the output to subwords seen at least threshold
+	// times in the training data, as apply_bpe.py --vocabulary does. Subwords
+	// that are not in it are split back with the merge operations.
+	Vocab map[string]bool
+	// UNK, if set, replaces the subwords that are still not in Vocab once
+	// fully split.
+	UNK string
+
+	ranks   map[pair]int
+	reverse map[string]pair
+
+	mu    sync.Mutex
+	cache map[string][]string
+}
+
+// LoadCodes reads the codes file at path written by learn_bpe.py.
+func LoadCodes(path string) (*BPE, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := ReadCodes(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return b, nil
+}
+
+// ReadCodes reads merge operations, one pair of symbols per line by
+// decreasing priority. A first line "#version: 0.2" selects the handling of
+// word endings of subword-nmt 0.2, the default is 0.1.
+func ReadCodes(r io.Reader) (*BPE, error) {
+	b := &BPE{
+		Version: 1,
+		ranks:   map[pair]int{},
+		reverse: map[string]pair{},
+		cache:   map[string][]string{},
+	}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if line == 1 && strings.HasPrefix(text, "#version:") {
+			switch v := strings.TrimSpace(strings.TrimPrefix(text, "#version:")); v {
+			case "0.1":
+				b.Version = 1
+			case "0.2":
+				b.Version = 2
+			default:
+				return nil, fmt.Errorf("line %d: unsupported version %q", line, v)
+			}
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: want a pair of symbols, got %q", line, text)
+		}
+		p := pair{fields[0], fields[1]}
+		// The first occurrence of a pair has the highest priority.
+		if _, ok := b.ranks[p]; !ok {
+			b.ranks[p] = len(b.ranks)
+			b.reverse[p.left+p.right] = p
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// LoadVocab reads a vocabulary file written by get_vocab.py, a subword and
+// its frequency per line, keeping the subwords seen at least threshold times.
+func LoadVocab(path string, threshold int) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	vocab := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want a subword and its frequency", path, line)
+		}
+		freq, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid frequency %q", path, line, fields[1])
+		}
+		if freq >= threshold {
+			vocab[fields[0]] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return vocab, nil
+}
+
+// SegmentLine segments the space separated tokens of s, see Segment.
+func (b *BPE) SegmentLine(s string) string {
+	return strings.Join(b.Segment(strings.Fields(s)), " ")
+}
+
+// Segment splits tokens into subwords, appending Separator to every subword
+// that does not end a token.
+func (b *BPE) Segment(tokens []string) []string {
+	var out []string
+	for _, token := range tokens {
+		subwords := b.SegmentWord(token)
+		for _, s := range subwords[:len(subwords)-1] {
+			out = append(out, s+Separator)
+		}
+		out = append(out, subwords[len(subwords)-1])
+	}
+	return out
+}
+
+// SegmentWord splits word into subwords, without separators. Like
+// apply_bpe.py, words of a single character are left alone.
+func (b *BPE) SegmentWord(word string) []string {
+	if utf8.RuneCountInString(word) <= 1 {
+		return []string{word}
+	}
+	b.mu.Lock()
+	subwords, ok := b.cache[word]
+	b.mu.Unlock()
+	if ok {
+		return subwords
+	}
+
+	subwords = b.merge(word)
+	if b.Vocab != nil {
+		subwords = b.restrict(subwords)
+	}
+
+	b.mu.Lock()
+	b.cache[word] = subwords
+	b.mu.Unlock()
+	return subwords
+}
+
+// merge applies the merge operations to the characters of word, the pair of
+// highest priority first, until none applies.
+func (b *BPE) merge(word string) []string {
+	chars := strings.Split(word, "")
+	var symbols []string
+	if b.Version == 1 {
+		symbols = append(chars, endOfWord)
+	} else {
+		symbols = append(chars[:len(chars)-1], chars[len(chars)-1]+endOfWord)
+	}
+
+	for len(symbols) > 1 {
+		best, bestRank := pair{}, -1
+		for i := 0; i+1 < len(symbols); i++ {
+			p := pair{symbols[i], symbols[i+1]}
+			if rank, ok := b.ranks[p]; ok && (bestRank < 0 || rank < bestRank) {
+				best, bestRank = p, rank
+			}
+		}
+		if bestRank < 0 {
+			break
+		}
+		merged := make([]string, 0, len(symbols))
+		for i := 0; i < len(symbols); i++ {
+			if i+1 < len(symbols) && symbols[i] == best.left && symbols[i+1] == best.right {
+				merged = append(merged, best.left+best.right)
+				i++
+				continue
+			}
+			merged = append(merged, symbols[i])
+		}
+		symbols = merged
+	}
+
+	// End of word markers are not part of the output.
+	last := symbols[len(symbols)-1]
+	if last == endOfWord {
+		symbols = symbols[:len(symbols)-1]
+	} else {
+		symbols[len(symbols)-1] = strings.TrimSuffix(last, endOfWord)
+	}
+	return symbols
+}
+
+// restrict splits the subwords that are not in the vocabulary back into
+// smaller subwords that are.
+func (b *BPE) restrict(subwords []string) []string {
+	var out []string
+	for i, s := range subwords {
+		final := i == len(subwords)-1
+		if b.inVocab(s, final) {
+			out = append(out, s)
+			continue
+		}
+		out = b.split(s, final, out)
+	}
+	if b.UNK != "" {
+		for i, s := range out {
+			if !b.inVocab(s, i == len(out)-1) {
+				out[i] = b.UNK
+			}
+		}
+	}
+	return out
+}
+
+// inVocab reports whether the subword is in the vocabulary, which holds the
+// subwords that do not end a word with their separator.
+func (b *BPE) inVocab(s string, final bool) bool {
+	if final {
+		return b.Vocab[s]
+	}
+	return b.Vocab[s+Separator]
+}
+
+// split reverses the merge that produced segment until its parts are in the
+// vocabulary or cannot be split, appending them to out.
+func (b *BPE) split(segment string, final bool, out []string) []string {
+	var (
+		p  pair
+		ok bool
+	)
+	if final {
+		p, ok = b.reverse[segment+endOfWord]
+		p.right = strings.TrimSuffix(p.right, endOfWord)
+	} else {
+		p, ok = b.reverse[segment]
+	}
+	if !ok {
+		return append(out, segment)
+	}
+
+	if b.inVocab(p.left, false) {
+		out = append(out, p.left)
+	} else {
+		out = b.split(p.left, false, out)
+	}
+	if b.inVocab(p.right, final) {
+		out = append(out, p.right)
+	} else {
+		out = b.split(p.right, final, out)
+	}
+	return out
+}
+
+// Join reverses the segmentation of s, removing every Separator followed by a
+// space or ending s, like sed -r 's/(@@ )|(@@ ?$)//g'.
+func Join(s string) string {
+	s = strings.Replace(s, Separator+" ", "", -1)
+	return strings.TrimSuffix(s, Separator)
+}
+
+// JoinTokens reverses the segmentation of subwords, concatenating each
+// subword ending with Separator with the next one.
+func JoinTokens(subwords []string) []string {
+	var (
+		out     []string
+		pending string
+	)
+	for _, s := range subwords {
+		if strings.HasSuffix(s, Separator) {
+			pending += strings.TrimSuffix(s, Separator)
+			continue
+		}
+		out = append(out, pending+s)
+		pending = ""
+	}
+	if pending != "" {
+		out = append(out, pending)
+	}
+	return out
+}
@@ -0,0 +1,152 @@
+package bpe
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The expected segmentations are those of apply_bpe.py of subword-nmt on the
+// same codes and vocabularies.
+
+const codesV1 = `l o
+lo w
+e r
+er </w>
+low </w>
+n e
+ne w
+new e
+newe s
+newes t
+t </w>
+`
+
+const codesV2 = `#version: 0.2
+l o
+lo w</w>
+lo w
+e r</w>
+n e
+ne w
+new e
+newe s
+newes t</w>
+`
+
+const line = "low lower newest lowest widest a aa"
+
+func readCodes(t *testing.T, codes string) *BPE {
+	b, err := ReadCodes(strings.NewReader(codes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestSegmentLine(t *testing.T) {
+	vocab := map[string]bool{"low@@": true, "low": true, "er": true, "new@@": true, "e@@": true, "s@@": true, "t": true, "w@@": true}
+	tests := []struct {
+		name    string
+		codes   string
+		version int
+		vocab   map[string]bool
+		want    string
+	}{
+		{"v0.1", codesV1, 1, nil, "low low@@ er newest low@@ e@@ s@@ t w@@ i@@ d@@ e@@ s@@ t a a@@ a"},
+		{"v0.2", codesV2, 2, nil, "low low@@ er newest low@@ e@@ s@@ t w@@ i@@ d@@ e@@ s@@ t a a@@ a"},
+		// v0.1 codes have no "newest </w>" merge to split the last subword
+		// back with, v0.2 codes end it with "newes t</w>".
+		{"v0.1 vocabulary", codesV1, 1, vocab, "low low@@ er newest low@@ e@@ s@@ t w@@ i@@ d@@ e@@ s@@ t a a@@ a"},
+		{"v0.2 vocabulary", codesV2, 2, vocab, "low low@@ er new@@ e@@ s@@ t low@@ e@@ s@@ t w@@ i@@ d@@ e@@ s@@ t a a@@ a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := readCodes(t, tt.codes)
+			if b.Version != tt.version {
+				t.Errorf("Version = %d, want %d", b.Version, tt.version)
+			}
+			b.Vocab = tt.vocab
+			if got := b.SegmentLine(line); got != tt.want {
+				t.Errorf("SegmentLine(%q) = %q, want %q", line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSegmentWordEndOfWord(t *testing.T) {
+	tests := []struct {
+		codes string
+		word  string
+		want  []string
+	}{
+		// "e r</w>" of v0.2 codes only merges at the end of a word.
+		{codesV1, "lower", []string{"low", "er"}},
+		{codesV1, "erl", []string{"er", "l"}},
+		{codesV2, "lower", []string{"low", "er"}},
+		{codesV2, "erl", []string{"e", "r", "l"}},
+		// "lo w</w>" ranks before "lo w" in v0.2 codes.
+		{codesV2, "low", []string{"low"}},
+		{codesV2, "lowe", []string{"low", "e"}},
+	}
+	for _, tt := range tests {
+		b := readCodes(t, tt.codes)
+		if got := b.SegmentWord(tt.word); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("v%d SegmentWord(%q) = %q, want %q", b.Version, tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestUNK(t *testing.T) {
+	b := readCodes(t, codesV2)
+	b.Vocab = map[string]bool{"low@@": true, "er": true}
+	b.UNK = "<unk>"
+	want := []string{"low@@", "er", "<unk>@@", "<unk>"}
+	if got := b.Segment([]string{"lower", "ab"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Segment = %q, want %q", got, want)
+	}
+}
+
+func TestReadCodesErrors(t *testing.T) {
+	for _, codes := range []string{"#version: 0.3\n", "a\n"} {
+		if _, err := ReadCodes(strings.NewReader(codes)); err == nil {
+			t.Errorf("ReadCodes(%q) succeeded, want an error", codes)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"low@@ er new@@ e@@ s@@ t", "lower newest"},
+		{"a b", "a b"},
+		{"trailing@@", "trailing"},
+		{"trailing@@ ", "trailing"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Join(tt.in); got != tt.want {
+			t.Errorf("Join(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestJoinTokens(t *testing.T) {
+	tests := []struct{ in, want []string }{
+		{[]string{"low@@", "er", "new@@", "e@@", "s@@", "t"}, []string{"lower", "newest"}},
+		{[]string{"a", "b"}, []string{"a", "b"}},
+		{[]string{"dangling@@"}, []string{"dangling"}},
+		{nil, nil},
+	}
+	for _, tt := range tests {
+		if got := JoinTokens(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("JoinTokens(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	b := readCodes(t, codesV2)
+	if got := Join(b.SegmentLine(line)); got != line {
+		t.Errorf("Join(SegmentLine(%q)) = %q", line, got)
+	}
+}
@@ -1,72 +1,64 @@
 package main
 
-// #cgo LDFLAGS: -ltensorflow
-// #cgo CFLAGS: -I${SRCDIR}/../../../tensorflow/tensorflow/
-// #include <stdlib.h>
-// #include "tensorflow/c/c_api.h"
-import "C"
-
 import (
-	// "path/filepath"
+	"flag"
+	"log"
 
-	"unsafe"
 	"github.com/k0kubun/pp"
-	// utils "github.com/rai-project/tensorflow-go-examples"
+	utils "github.com/rai-project/tensorflow-go-examples"
 	tf "github.com/tensorflow/tensorflow/tensorflow/go"
 )
 
-var (
-	dir = "/home/abduld/mlperf/inference/v0.5/translation/gnmt/tensorflow/savedmodel"
-)
-
 // translate.ckpt.data-00000-of-00001  translate.ckpt.index  translate.ckpt.meta
 
 func main() {
+	// Parse flags
+	modeldir := flag.String("dir", "/home/abduld/mlperf/inference/v0.5/translation/gnmt/tensorflow/savedmodel", "SavedModel directory exported as described in README.md")
+	signature := flag.String("signature", "serving_default", "Signature def to run, empty to only list the signature defs")
+	sentence := flag.String("sentence", "Hello world .", "Tokenized source sentence")
+	oplib := flag.String("op-library", "_beam_search_ops.so", "Shared library defining the GatherTree op of the beam search decoder")
+	flag.Parse()
 
+	// Register the ops of tf.contrib.seq2seq before loading the graph
+	lib, err := utils.LoadOpLibrary(*oplib)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pp.Println(lib.Ops)
 
-	pth := C.CString("_beam_search_ops.so")
-	C.free(unsafe.Pointer(pth))
-	stat := C.TF_NewStatus()
-	C.TF_LoadLibrary(pth, stat);
-	pp.Println( C.GoString(C.TF_Message(stat)))
-
-	model, err := tf.LoadSavedModel(dir, []string{"train", "serve"}, nil)
+	tags := []string{"train", "serve"}
+	sigs, err := utils.ReadSignatures(*modeldir, tags)
 	if err != nil {
-		pp.Printf("Error loading saved model: %s\n", err.Error())
+		log.Fatal(err)
+	}
+	pp.Println(sigs)
+	if *signature == "" {
 		return
 	}
 
-	defer model.Session.Close()
-
-	// // Input op
-	// inputOp := graph.Operation("input")
-
-	// // Output ops
-	// o1 := graph.Operation("MobilenetV1/Predictions/Reshape_1")
-
-	// // Execute COCO Graph
-	// output, err := model.session.Run(
-	// 	map[tf.Output]*tf.Tensor{
-	// 		inputOp.Output(0): tensor,
-	// 	},
-	// 	[]tf.Output{
-	// 		o1.Output(0),
-	// 	},
-	// 	nil)
-	// if err != nil {
-	// 	log.Fatal(err)
-	// }
-	// // Take the first in the batched output
-	// probabilities := output[0].Value().([][]float32)[0]
+	// Load the graph with the inputs and outputs of the signature
+	model, err := utils.LoadSignature(*modeldir, tags, *signature, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer model.Close()
 
-	// idxs := make([]int, len(probabilities))
-	// for i := range probabilities {
-	// 	idxs[i] = i
-	// }
-	// preds := utils.Predictions{Probabilities: probabilities, Indexes: idxs}
-	// sort.Sort(preds)
+	source, err := tf.NewTensor([]string{*sentence})
+	if err != nil {
+		log.Fatal(err)
+	}
+	batchSize, err := tf.NewTensor(int64(1))
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// for ii := 0; ii < 1; ii++ {
-	// 	pp.Println(preds.Indexes[ii], labels[preds.Indexes[ii]], preds.Probabilities[ii])
-	// }
+	// Execute GNMT Graph
+	output, err := model.Run(map[string]*tf.Tensor{
+		"source":     source,
+		"batch_size": batchSize,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	pp.Println(output["translations"].Value())
 }
@@ -0,0 +1,119 @@
+package nmt
+
+import (
+	"fmt"
+
+	utils "github.com/rai-project/tensorflow-go-examples"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// SourceBatch converts the token ids of a batch of sentences into the
+// [batch, time] id matrix fed to the encoder, padded with eos as nmt does,
+// and the [batch] sentence lengths.
+func SourceBatch(ids [][]int32, eos int32) (*tf.Tensor, *tf.Tensor, error) {
+	maxLen := 0
+	for _, s := range ids {
+		if len(s) > maxLen {
+			maxLen = len(s)
+		}
+	}
+	matrix := make([][]int32, len(ids))
+	lengths := make([]int32, len(ids))
+	for i, s := range ids {
+		row := make([]int32, maxLen)
+		n := copy(row, s)
+		for j := n; j < maxLen; j++ {
+			row[j] = eos
+		}
+		matrix[i] = row
+		lengths[i] = int32(len(s))
+	}
+	source, err := tf.NewTensor(matrix)
+	if err != nil {
+		return nil, nil, err
+	}
+	length, err := tf.NewTensor(lengths)
+	if err != nil {
+		return nil, nil, err
+	}
+	return source, length, nil
+}
+
+// Beams holds the hypotheses of a beam search decoder, indexed by sentence,
+// beam and time step. Greedy decoders have a single beam.
+type Beams struct {
+	Batch, Width, Time int
+	// at returns the index in the flattened output of step t of beam k of
+	// sentence b.
+	at func(b, k, t int) int
+}
+
+// NewBeams describes a decoder output of shape [time, batch] or [time,
+// batch, beam] if timeMajor, as in graphs trained by nmt with the default
+// time_major, and [batch, time] or [batch, time, beam] otherwise.
+func NewBeams(shape []int64, timeMajor bool) (*Beams, error) {
+	var time, batch, width int
+	switch len(shape) {
+	case 2:
+		width = 1
+	case 3:
+		width = int(shape[2])
+	default:
+		return nil, fmt.Errorf("unexpected decoder output of shape %v", shape)
+	}
+	if timeMajor {
+		time, batch = int(shape[0]), int(shape[1])
+		return &Beams{batch, width, time, func(b, k, t int) int {
+			return (t*batch+b)*width + k
+		}}, nil
+	}
+	batch, time = int(shape[0]), int(shape[1])
+	return &Beams{batch, width, time, func(b, k, t int) int {
+		return (b*time+t)*width + k
+	}}, nil
+}
+
+// IDs returns the token ids of beam k of every sentence of the decoder output
+// t, described by beams.
+func (beams *Beams) IDs(t *tf.Tensor, k int) ([][]int32, error) {
+	var flat []int32
+	switch v := utils.FlattenTensor(t).(type) {
+	case []int32:
+		flat = v
+	case []int64:
+		flat = make([]int32, len(v))
+		for i, id := range v {
+			flat[i] = int32(id)
+		}
+	default:
+		return nil, fmt.Errorf("unexpected decoder output of type %v", t.DataType())
+	}
+	ids := make([][]int32, beams.Batch)
+	for b := range ids {
+		ids[b] = make([]int32, beams.Time)
+		for s := range ids[b] {
+			ids[b][s] = flat[beams.at(b, k, s)]
+		}
+	}
+	return ids, nil
+}
+
+// Words returns the tokens of beam k of every sentence of the decoder output
+// t, described by beams, stopping at the first EOS.
+func (beams *Beams) Words(t *tf.Tensor, k int) ([][]string, error) {
+	flat, ok := utils.FlattenTensor(t).([]string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected decoder output of type %v", t.DataType())
+	}
+	words := make([][]string, beams.Batch)
+	for b := range words {
+		for s := 0; s < beams.Time; s++ {
+			w := flat[beams.at(b, k, s)]
+			if w == EOS {
+				break
+			}
+			words[b] = append(words[b], w)
+		}
+	}
+	return words, nil
+}
@@ -0,0 +1,85 @@
+package nmt
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenize splits s on white space and splits the punctuation that starts or
+// ends a word into tokens of its own, like the tokenizer of the WMT training
+// data does: "Hello, world!" becomes "Hello , world !". Punctuation inside
+// words, as in "U.S", "3.5" or "don't", is kept, and so is the "@@" that ends
+// the subwords of BPE segmented text. Tokenizing tokenized text does not
+// change it.
+func Tokenize(s string) []string {
+	var tokens []string
+	for _, field := range strings.Fields(s) {
+		if strings.HasSuffix(field, subwordSeparator) && len(field) > len(subwordSeparator) {
+			tokens = append(tokens, field)
+			continue
+		}
+		var trailing []string
+		for field != "" {
+			r, n := utf8.DecodeRuneInString(field)
+			if !isPunct(r) {
+				break
+			}
+			tokens = append(tokens, field[:n])
+			field = field[n:]
+		}
+		for field != "" {
+			r, n := utf8.DecodeLastRuneInString(field)
+			if !isPunct(r) {
+				break
+			}
+			trailing = append(trailing, field[len(field)-n:])
+			field = field[:len(field)-n]
+		}
+		if field != "" {
+			tokens = append(tokens, field)
+		}
+		for i := len(trailing) - 1; i >= 0; i-- {
+			tokens = append(tokens, trailing[i])
+		}
+	}
+	return tokens
+}
+
+const subwordSeparator = "@@"
+
+func isPunct(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+// Punctuation attached to the previous and to the next token by Detokenize.
+var (
+	attachLeft  = map[string]bool{".": true, ",": true, "!": true, "?": true, ";": true, ":": true, "%": true, ")": true, "]": true, "}": true, "»": true, "“": true, "…": true}
+	attachRight = map[string]bool{"(": true, "[": true, "{": true, "«": true, "„": true, "¿": true, "¡": true}
+)
+
+// Detokenize joins tokens with spaces, except around punctuation, reversing
+// Tokenize. Straight double quotes alternate between opening and closing.
+func Detokenize(tokens []string) string {
+	var b strings.Builder
+	noSpace := true
+	openQuote := false
+	for _, t := range tokens {
+		left := attachLeft[t]
+		right := attachRight[t]
+		if t == `"` {
+			if openQuote {
+				left = true
+			} else {
+				right = true
+			}
+			openQuote = !openQuote
+		}
+		if !noSpace && !left {
+			b.WriteByte(' ')
+		}
+		b.WriteString(t)
+		noSpace = right
+	}
+	return b.String()
+}
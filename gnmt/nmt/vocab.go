@@ -0,0 +1,108 @@
+// Package nmt prepares the inputs and reads the outputs of GNMT models
+// trained with the tensorflow/nmt code base: vocabularies, tokenization and
+// the padded id tensors fed to the encoder.
+package nmt
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Special tokens of nmt vocabularies, which start with them in this order.
+const (
+	UNK = "<unk>"
+	SOS = "<s>"
+	EOS = "</s>"
+)
+
+// Vocab maps the tokens of a vocabulary file to their ids, the line numbers.
+type Vocab struct {
+	Words []string
+	ids   map[string]int32
+}
+
+// NewVocab returns the vocabulary of words. Like nmt, the special tokens are
+// prepended if words does not start with them.
+func NewVocab(words []string) *Vocab {
+	if len(words) < 3 || words[0] != UNK || words[1] != SOS || words[2] != EOS {
+		words = append([]string{UNK, SOS, EOS}, words...)
+	}
+	v := &Vocab{Words: words, ids: make(map[string]int32, len(words))}
+	for i, w := range words {
+		if _, ok := v.ids[w]; !ok {
+			v.ids[w] = int32(i)
+		}
+	}
+	return v
+}
+
+// LoadVocab reads a vocabulary file with one token per line.
+func LoadVocab(path string) (*Vocab, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		w := strings.TrimSpace(scanner.Text())
+		if w == "" {
+			continue
+		}
+		words = append(words, w)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read vocabulary %s: %v", path, err)
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("vocabulary %s is empty", path)
+	}
+	return NewVocab(words), nil
+}
+
+// Size returns the number of tokens of the vocabulary.
+func (v *Vocab) Size() int {
+	return len(v.Words)
+}
+
+// ID returns the id of word, the id of UNK if word is unknown.
+func (v *Vocab) ID(word string) int32 {
+	if id, ok := v.ids[word]; ok {
+		return id
+	}
+	return v.ids[UNK]
+}
+
+// Word returns the token of id, UNK if id is out of range.
+func (v *Vocab) Word(id int32) string {
+	if id < 0 || int(id) >= len(v.Words) {
+		return UNK
+	}
+	return v.Words[id]
+}
+
+// Encode maps tokens to their ids.
+func (v *Vocab) Encode(tokens []string) []int32 {
+	ids := make([]int32, len(tokens))
+	for i, t := range tokens {
+		ids[i] = v.ID(t)
+	}
+	return ids
+}
+
+// Decode maps ids to their tokens, stopping at the first EOS.
+func (v *Vocab) Decode(ids []int32) []string {
+	eos := v.ID(EOS)
+	tokens := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == eos {
+			break
+		}
+		tokens = append(tokens, v.Word(id))
+	}
+	return tokens
+}
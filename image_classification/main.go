@@ -2,104 +2,80 @@ package main
 
 import (
 	"flag"
-	"io/ioutil"
 	"log"
-	"path/filepath"
-	"sort"
+	"os"
 
-	"github.com/disintegration/imaging"
-	"github.com/k0kubun/pp"
 	utils "github.com/rai-project/tensorflow-go-examples"
 	tf "github.com/tensorflow/tensorflow/tensorflow/go"
 )
 
 func main() {
 	// Parse flags
-	modeldir := flag.String("dir", "", "Directory containing trained model files. Assumes model file is called frozen_inference_graph.pb")
-	jpgfile := flag.String("jpg", "platypus.jpg", "Path of a JPG image to use for input")
-	labelfile := flag.String("labels", "synset1.txt", "Path to file of COCO labels, one per line")
+	modeldir := flag.String("dir", "", "Directory containing trained model files. Assumes model file is called mobilenet_v1_1.0_224_frozen.pb unless the manifest says otherwise")
+	manifestfile := flag.String("manifest", "model.yml", "Path of the model manifest describing the graph, its inputs and outputs")
+	oplibs := flag.String("op-library", "", "Comma separated shared libraries of custom ops to load before the model")
+	jpgfile := flag.String("jpg", "platypus.jpg", "Path of an image (JPEG, PNG, GIF, BMP, TIFF or WebP) to use for input")
+	labelfile := flag.String("labels", "", "Path to file of ImageNet labels, one per line. Defaults to the labels of the manifest")
+	topk := flag.Int("topk", 1, "Number of most probable classes to print")
+	minprob := flag.Float64("min-prob", 0, "Minimum probability of the classes printed")
+	format := flag.String("format", "text", "Output format: text, json or csv")
 	flag.Parse()
-	if *modeldir == "" || *jpgfile == "" {
+	if *modeldir == "" || *jpgfile == "" || *topk <= 0 {
 		flag.Usage()
 		return
 	}
 
-	// Load the labels
-	labels := utils.LoadLabels(*labelfile)
-
-	// Load a frozen graph to use for queries
-	modelpath := filepath.Join(*modeldir, "mobilenet_v1_1.0_224_frozen.pb")
-	model, err := ioutil.ReadFile(modelpath)
-	if err != nil {
+	// Register the custom ops the graph may use before loading it
+	if _, err := utils.LoadOpLibraries(*oplibs); err != nil {
 		log.Fatal(err)
 	}
 
-	// Construct an in-memory graph from the serialized form.
-	graph := tf.NewGraph()
-	if err := graph.Import(model, ""); err != nil {
+	manifest, err := utils.LoadManifest(*manifestfile)
+	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Create a session for inference over graph.
-	session, err := tf.NewSession(graph, nil)
-	if err != nil {
+	// Load the labels
+	var labels []string
+	if *labelfile != "" {
+		labels = utils.LoadLabels(*labelfile)
+	} else if labels, err = manifest.LoadLabels(); err != nil {
 		log.Fatal(err)
 	}
-	defer session.Close()
 
-	img, err := imaging.Open(*jpgfile)
+	// Load the graph described by the manifest
+	model, err := manifest.Load(*modeldir, nil)
 	if err != nil {
-		log.Fatalf("failed to open image: %v", err)
+		log.Fatal(err)
 	}
+	defer model.Close()
 
-	height := 224
-	width := 224
-	resized := imaging.Resize(img, width, height, imaging.Linear)
-	imgFloats, err := utils.NormalizeImageHWC(resized, []float32{128, 128, 128}, 128)
+	img, err := utils.OpenImage(*jpgfile)
 	if err != nil {
-		panic(err)
-	}
-
-	batchSize := 1
-	input := make([][]float32, batchSize)
-	for ii := 0; ii < batchSize; ii++ {
-		input[ii] = imgFloats
+		log.Fatal(err)
 	}
 
-	tensor, err := utils.ReshapeTensorFloats(input, []int64{int64(batchSize), int64(height), int64(width), 3})
+	// Resize and normalize the image as declared in the manifest
+	tensor, err := manifest.Preprocessing.Tensor(img, tf.Float)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Input op
-	inputOp := graph.Operation("input")
-
-	// Output ops
-	o1 := graph.Operation("MobilenetV1/Predictions/Reshape_1")
-
-	// Execute COCO Graph
-	output, err := session.Run(
-		map[tf.Output]*tf.Tensor{
-			inputOp.Output(0): tensor,
-		},
-		[]tf.Output{
-			o1.Output(0),
-		},
-		nil)
+	// Execute MobileNet Graph
+	output, err := model.Run(map[string]*tf.Tensor{
+		"images": tensor,
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
 	// Take the first in the batched output
-	probabilities := output[0].Value().([][]float32)[0]
+	probabilities := output["probabilities"].Value().([][]float32)[0]
 
-	idxs := make([]int, len(probabilities))
-	for i := range probabilities {
-		idxs[i] = i
-	}
-	preds := utils.Predictions{Probabilities: probabilities, Indexes: idxs}
-	sort.Sort(preds)
+	// Select the most probable classes without sorting all of them
+	preds := utils.TopK(probabilities, *topk).Above(float32(*minprob))
 
-	for ii := 0; ii < 1; ii++ {
-		pp.Println(preds.Indexes[ii], labels[preds.Indexes[ii]], preds.Probabilities[ii])
+	results := []utils.Classification{preds.Classification(*jpgfile, labels)}
+	if err := utils.WriteClassifications(os.Stdout, *format, results); err != nil {
+		log.Fatal(err)
 	}
 }
@@ -5,10 +5,8 @@ import (
 	"image"
 	"image/draw"
 	"image/jpeg"
-	"io/ioutil"
 	"log"
 	"os"
-	"path/filepath"
 
 	"github.com/k0kubun/pp"
 
@@ -19,41 +17,45 @@ import (
 
 func main() {
 	// Parse flags
-	modeldir := flag.String("dir", "", "Directory containing trained model files. Assumes model file is called frozen_inference_graph.pb")
-	jpgfile := flag.String("jpg", "lane_control.jpg", "Path of a JPG image to use for input")
+	modeldir := flag.String("dir", "", "Directory containing trained model files. Assumes model file is called frozen_inference_graph.pb unless the manifest says otherwise")
+	manifestfile := flag.String("manifest", "model.yml", "Path of the model manifest describing the graph, its inputs and outputs")
+	oplibs := flag.String("op-library", "", "Comma separated shared libraries of custom ops to load before the model")
+	jpgfile := flag.String("jpg", "lane_control.jpg", "Path of an image (JPEG, PNG, GIF, BMP, TIFF or WebP) to use for input")
 	outjpg := flag.String("out", "output.jpg", "Path of output JPG for displaying labels. Default is output.jpg")
-	labelfile := flag.String("labels", "coco_labels.txt", "Path to file of COCO labels, one per line")
+	labelfile := flag.String("labels", "", "Path to file of COCO labels, one per line. Defaults to the labels of the manifest")
 	flag.Parse()
 	if *modeldir == "" || *jpgfile == "" {
 		flag.Usage()
 		return
 	}
 
-	// Load the labels
-	labels := utils.LoadLabels(*labelfile)
+	// Register the custom ops the graph may use before loading it
+	if _, err := utils.LoadOpLibraries(*oplibs); err != nil {
+		log.Fatal(err)
+	}
 
-	// Load a frozen graph to use for queries
-	modelpath := filepath.Join(*modeldir, "frozen_inference_graph.pb")
-	model, err := ioutil.ReadFile(modelpath)
+	manifest, err := utils.LoadManifest(*manifestfile)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Construct an in-memory graph from the serialized form.
-	graph := tf.NewGraph()
-	if err := graph.Import(model, ""); err != nil {
+	// Load the labels
+	var labels []string
+	if *labelfile != "" {
+		labels = utils.LoadLabels(*labelfile)
+	} else if labels, err = manifest.LoadLabels(); err != nil {
 		log.Fatal(err)
 	}
 
-	// Create a session for inference over graph.
-	session, err := tf.NewSession(graph, nil)
+	// Load the graph described by the manifest
+	model, err := manifest.Load(*modeldir, nil)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer session.Close()
+	defer model.Close()
 
-	// DecodeJpeg uses a scalar String-valued tensor as input.
-	tensor, i, err := utils.MakeTensorFromImage(*jpgfile)
+	// Decode the image, whatever its format, into a uint8 tensor
+	tensor, i, err := utils.DecodeImageFile(*jpgfile)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -61,40 +63,23 @@ func main() {
 	// Print the image tensor
 	// utils.ToPng("/tmp/object_detection.png", utils.TensorData(utils.TensorPtrC(tensor)), i.Bounds())
 
-	// Transform the decoded YCbCr JPG image into RGBA
+	// Transform the decoded image into RGBA
 	b := i.Bounds()
 	img := image.NewRGBA(b)
 	draw.Draw(img, b, i, b.Min, draw.Src)
 
-	// Input op
-	inputOp := graph.Operation("image_tensor")
-
-	// Output ops
-	o1 := graph.Operation("detection_boxes")
-	o2 := graph.Operation("detection_scores")
-	o3 := graph.Operation("detection_classes")
-	o4 := graph.Operation("num_detections")
-
 	// Execute COCO Graph
-	output, err := session.Run(
-		map[tf.Output]*tf.Tensor{
-			inputOp.Output(0): tensor,
-		},
-		[]tf.Output{
-			o1.Output(0),
-			o2.Output(0),
-			o3.Output(0),
-			o4.Output(0),
-		},
-		nil)
+	output, err := model.Run(map[string]*tf.Tensor{
+		"images": tensor,
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	// Take the first in the batched output
-	boxes := output[0].Value().([][][]float32)[0]
-	probabilities := output[1].Value().([][]float32)[0]
-	classes := output[2].Value().([][]float32)[0]
+	boxes := output["boxes"].Value().([][][]float32)[0]
+	probabilities := output["scores"].Value().([][]float32)[0]
+	classes := output["classes"].Value().([][]float32)[0]
 
 	m := float32(0.0)
 	for i, e := range probabilities {
@@ -5,10 +5,8 @@ import (
 	"image"
 	"image/color"
 	"image/jpeg"
-	"io/ioutil"
 	"log"
 	"os"
-	"path/filepath"
 
 	"github.com/disintegration/imaging"
 
@@ -41,8 +39,10 @@ func createPascalLabelColorMap() [256][3]int32 {
 
 func main() {
 	// Parse flags
-	modeldir := flag.String("dir", "", "Directory containing trained model files. Assumes model file is called frozen_inference_graph.pb")
-	jpgfile := flag.String("jpg", "lane_control.jpg", "Path of a JPG image to use for input")
+	modeldir := flag.String("dir", "", "Directory containing trained model files. Assumes model file is called frozen_inference_graph.pb unless the manifest says otherwise")
+	manifestfile := flag.String("manifest", "model.yml", "Path of the model manifest describing the graph, its inputs and outputs")
+	oplibs := flag.String("op-library", "", "Comma separated shared libraries of custom ops to load before the model")
+	jpgfile := flag.String("jpg", "lane_control.jpg", "Path of an image (JPEG, PNG, GIF, BMP, TIFF or WebP) to use for input")
 	outjpg := flag.String("out", "output.jpg", "Path of output JPG for displaying labels. Default is output.jpg")
 	flag.Parse()
 	if *modeldir == "" || *jpgfile == "" {
@@ -50,52 +50,38 @@ func main() {
 		return
 	}
 
-	// Load a frozen graph to use for queries
-	modelpath := filepath.Join(*modeldir, "frozen_inference_graph.pb")
-	model, err := ioutil.ReadFile(modelpath)
-	if err != nil {
+	// Register the custom ops the graph may use before loading it
+	if _, err := utils.LoadOpLibraries(*oplibs); err != nil {
 		log.Fatal(err)
 	}
 
-	// Construct an in-memory graph from the serialized form.
-	graph := tf.NewGraph()
-	if err := graph.Import(model, ""); err != nil {
+	manifest, err := utils.LoadManifest(*manifestfile)
+	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Create a session for inference over graph.
-	session, err := tf.NewSession(graph, nil)
+	// Load the graph described by the manifest
+	model, err := manifest.Load(*modeldir, nil)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer session.Close()
+	defer model.Close()
 
-	inputSize := 513
+	inputSize := manifest.Preprocessing.Size
 	tensor, img, targetWidth, targetHeight, err := utils.MakeTensorFromResizedImage(*jpgfile, int32(inputSize))
 	if err != nil {
 		log.Fatal(err)
 	}
-	// Input op
-	inputOp := graph.Operation("ImageTensor")
-
-	// Output ops
-	outputOp := graph.Operation("SemanticPredictions")
-
-	// Execute COCO Graph
-	output, err := session.Run(
-		map[tf.Output]*tf.Tensor{
-			inputOp.Output(0): tensor,
-		},
-		[]tf.Output{
-			outputOp.Output(0),
-		},
-		nil)
+	// Execute DeepLab Graph
+	output, err := model.Run(map[string]*tf.Tensor{
+		"images": tensor,
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	// Take the first in the batched output
-	seg := output[0].Value().([][][]int64)[0]
+	seg := output["segmentation"].Value().([][][]int64)[0]
 
 	colorMap := createPascalLabelColorMap()
 	imgSeg := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// INPUT FILES
+
+// ImageExtensions are the extensions of the files taken as images, matched
+// case insensitively.
+var ImageExtensions = []string{".jpg", ".jpeg", ".png", ".gif", ".bmp", ".tif", ".tiff", ".webp"}
+
+// IsImagePath reports whether path has one of the ImageExtensions.
+func IsImagePath(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range ImageExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// ImageInput is an image to process. Name is the path of the image relative
+// to the directory it was listed from, under which its outputs are written to
+// mirror the inputs.
+type ImageInput struct {
+	Path string
+	Name string
+}
+
+// ImageInputs lists the images of spec, which is either
+//   - a directory, whose images are listed recursively, named relative to it;
+//   - a glob pattern, whose matching files are named relative to the
+//     directory before the first wildcard;
+//   - a file listing one path per line, named relative to the directory
+//     common to every path; blank lines and lines starting with # are skipped;
+//   - or an image, named by its base name.
+//
+// Images are listed in lexical order, list files in the order of their lines.
+func ImageInputs(spec string) ([]ImageInput, error) {
+	if hasGlobMeta(spec) {
+		matches, err := filepath.Glob(spec)
+		if err != nil {
+			return nil, err
+		}
+		var paths []string
+		for _, path := range matches {
+			if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+				paths = append(paths, path)
+			}
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no file matches %s", spec)
+		}
+		base := spec
+		for hasGlobMeta(base) {
+			base = filepath.Dir(base)
+		}
+		return namedInputs(base, paths)
+	}
+
+	fi, err := os.Stat(spec)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		var paths []string
+		err := filepath.Walk(spec, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && IsImagePath(path) {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return namedInputs(spec, paths)
+	}
+	if IsImagePath(spec) {
+		return []ImageInput{{Path: spec, Name: filepath.Base(spec)}}, nil
+	}
+
+	paths, err := readImageList(spec)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%s lists no images", spec)
+	}
+	return namedInputs(commonDir(paths), paths)
+}
+
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[`)
+}
+
+// readImageList reads the paths of a list file.
+func readImageList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var paths []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return paths, nil
+}
+
+// commonDir returns the deepest directory containing every path.
+func commonDir(paths []string) string {
+	dir := ""
+	for i, path := range paths {
+		abs, err := filepath.Abs(filepath.Dir(path))
+		if err != nil {
+			return "."
+		}
+		if i == 0 {
+			dir = abs
+			continue
+		}
+		for dir != abs && !strings.HasPrefix(abs, dir+string(filepath.Separator)) {
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+	return dir
+}
+
+// namedInputs names paths relative to base.
+func namedInputs(base string, paths []string) ([]ImageInput, error) {
+	absBase, err := filepath.Abs(base)
+	if err != nil {
+		return nil, err
+	}
+	inputs := make([]ImageInput, len(paths))
+	for i, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		name, err := filepath.Rel(absBase, abs)
+		if err != nil {
+			return nil, err
+		}
+		inputs[i] = ImageInput{Path: path, Name: name}
+	}
+	return inputs, nil
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImageInputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inputs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.jpg", "b.PNG", "notes.txt", "sub/c.jpeg", "sub/deep/d.webp", "other/e.gif"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	join := func(name string) string { return filepath.Join(dir, filepath.FromSlash(name)) }
+	list := strings.Join([]string{
+		"# images",
+		join("sub/deep/d.webp"),
+		"",
+		"  " + join("sub/c.jpeg") + "  ",
+	}, "\n")
+	if err := ioutil.WriteFile(join("list.txt"), []byte(list), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		spec string
+		want []string
+	}{
+		{"directory", dir, []string{"a.jpg", "b.PNG", "other/e.gif", "sub/c.jpeg", "sub/deep/d.webp"}},
+		{"subdirectory", join("sub"), []string{"c.jpeg", "deep/d.webp"}},
+		{"glob", join("sub/*/*.webp"), []string{"deep/d.webp"}},
+		{"glob of any file", join("*.*"), []string{"a.jpg", "b.PNG", "list.txt", "notes.txt"}},
+		{"list", join("list.txt"), []string{"deep/d.webp", "c.jpeg"}},
+		{"image", join("sub/c.jpeg"), []string{"c.jpeg"}},
+	}
+	for _, tt := range tests {
+		inputs, err := ImageInputs(tt.spec)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var names []string
+		for _, in := range inputs {
+			names = append(names, filepath.ToSlash(in.Name))
+			if _, err := os.Stat(in.Path); err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+		}
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("%s: ImageInputs names = %v, want %v", tt.name, names, tt.want)
+		}
+	}
+}
+
+func TestImageInputsErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inputs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	empty := filepath.Join(dir, "empty.txt")
+	if err := ioutil.WriteFile(empty, []byte("# nothing\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct{ name, spec, want string }{
+		{"missing", filepath.Join(dir, "missing.jpg"), "no such file"},
+		{"no match", filepath.Join(dir, "*.jpg"), "no file matches"},
+		{"empty list", empty, "lists no images"},
+	}
+	for _, tt := range tests {
+		_, err := ImageInputs(tt.spec)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: ImageInputs error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestCommonDir(t *testing.T) {
+	tests := []struct {
+		paths []string
+		want  string
+	}{
+		{[]string{"/a/b/x.jpg"}, "/a/b"},
+		{[]string{"/a/b/x.jpg", "/a/b/c/y.jpg"}, "/a/b"},
+		{[]string{"/a/b/x.jpg", "/a/bc/y.jpg"}, "/a"},
+		{[]string{"/a/x.jpg", "/b/y.jpg"}, "/"},
+	}
+	for _, tt := range tests {
+		if filepath.Separator != '/' {
+			t.Skip("paths are POSIX")
+		}
+		if got := commonDir(tt.paths); got != tt.want {
+			t.Errorf("commonDir(%v) = %q, want %q", tt.paths, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/golang/protobuf/proto"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// GRAPH INSPECTION
+
+// GraphInfo summarizes a graph: what to feed, what to fetch and what it is
+// made of. Shapes are nil when the rank is unknown.
+type GraphInfo struct {
+	Placeholders []TensorSpec   `json:"placeholders"`
+	Outputs      []TensorSpec   `json:"outputs"`
+	Ops          map[string]int `json:"ops"`
+	NumOps       int            `json:"num_ops"`
+	Parameters   int64          `json:"parameters"`
+	Tags         []string       `json:"tags,omitempty"`
+	Signatures   []Signature    `json:"signatures,omitempty"`
+}
+
+// Ops that are never outputs of interest even when nothing consumes them.
+var ignoredOutputTypes = map[string]bool{
+	"Const":                  true,
+	"NoOp":                   true,
+	"Placeholder":            true,
+	"PlaceholderWithDefault": true,
+	"VariableV2":             true,
+	"VarHandleOp":            true,
+}
+
+// InspectGraph lists the placeholders of graph, its candidate outputs (the
+// ops whose outputs nothing consumes), how many ops of each type it has and
+// its number of parameters: the elements of its float constants and
+// variables with a known shape.
+func InspectGraph(graph *tf.Graph) *GraphInfo {
+	info := &GraphInfo{Ops: map[string]int{}}
+	ops := graph.Operations()
+	for i := range ops {
+		op := &ops[i]
+		info.NumOps++
+		info.Ops[op.Type()]++
+
+		switch op.Type() {
+		case "Placeholder":
+			info.Placeholders = append(info.Placeholders, specOf(op.Name(), op.Output(0)))
+		case "Const", "VariableV2", "VarHandleOp":
+			info.Parameters += parameters(op)
+		}
+
+		// Savers and initializers dangle in every graph with variables.
+		if ignoredOutputTypes[op.Type()] || strings.HasPrefix(op.Name(), "save/") || op.NumOutputs() == 0 {
+			continue
+		}
+		consumed := false
+		for j := 0; j < op.NumOutputs(); j++ {
+			if len(op.Output(j).Consumers()) != 0 {
+				consumed = true
+				break
+			}
+		}
+		if consumed {
+			continue
+		}
+		for j := 0; j < op.NumOutputs(); j++ {
+			name := op.Name()
+			if op.NumOutputs() > 1 {
+				name = fmt.Sprintf("%s:%d", op.Name(), j)
+			}
+			info.Outputs = append(info.Outputs, specOf(name, op.Output(j)))
+		}
+	}
+
+	byName := func(specs []TensorSpec) {
+		sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+	}
+	byName(info.Placeholders)
+	byName(info.Outputs)
+	return info
+}
+
+func specOf(name string, output tf.Output) TensorSpec {
+	spec := TensorSpec{Name: name, DType: DataTypeName(output.DataType())}
+	if shape, err := output.Shape().ToSlice(); err == nil {
+		spec.Shape = shape
+		if spec.Shape == nil {
+			spec.Shape = []int64{}
+		}
+	}
+	return spec
+}
+
+// parameters returns the number of float elements produced by a constant or
+// held by a variable, 0 if its shape is not fully known.
+func parameters(op *tf.Operation) int64 {
+	output := op.Output(0)
+	dtype := output.DataType()
+	if dtype > 100 {
+		// Reference types, such as the outputs of VariableV2, are offset
+		// by 100.
+		dtype -= 100
+	}
+	switch dtype {
+	case tf.Float, tf.Double, tf.Half, tf.Bfloat16, tf.Resource:
+	default:
+		return 0
+	}
+	if op.Type() == "VarHandleOp" {
+		// Resource variables carry their shape as an attribute.
+		v, err := op.Attr("shape")
+		if err != nil {
+			return 0
+		}
+		shape, ok := v.(tf.Shape)
+		if !ok {
+			return 0
+		}
+		return knownElements(shape)
+	}
+	return knownElements(output.Shape())
+}
+
+func knownElements(shape tf.Shape) int64 {
+	if !shape.IsFullySpecified() {
+		return 0
+	}
+	dims, err := shape.ToSlice()
+	if err != nil {
+		return 0
+	}
+	return NumElements(dims)
+}
+
+// InspectFrozenGraph inspects the frozen GraphDef stored at path.
+func InspectFrozenGraph(path string) (*GraphInfo, error) {
+	def, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkGraphDef(def); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	graph := tf.NewGraph()
+	if err := graph.Import(def, ""); err != nil {
+		return nil, fmt.Errorf("failed to import %s: %v", path, err)
+	}
+	return InspectGraph(graph), nil
+}
+
+// InspectSavedModel inspects the meta graph of the SavedModel in dir tagged
+// with tags, including its signature defs. Variables are not restored.
+func InspectSavedModel(dir string, tags []string) (*GraphInfo, error) {
+	mg, err := ReadMetaGraph(dir, tags)
+	if err != nil {
+		return nil, err
+	}
+	if mg.GraphDef == nil {
+		return nil, fmt.Errorf("%s: meta graph has no graph_def", dir)
+	}
+	if err := CheckGraphOps(mg.GraphDef); err != nil {
+		return nil, fmt.Errorf("%s: %v", dir, err)
+	}
+	def, err := proto.Marshal(mg.GraphDef)
+	if err != nil {
+		return nil, err
+	}
+	graph := tf.NewGraph()
+	if err := graph.Import(def, ""); err != nil {
+		return nil, fmt.Errorf("failed to import the graph of %s: %v", dir, err)
+	}
+
+	info := InspectGraph(graph)
+	info.Tags = tags
+	info.Signatures = Signatures(mg)
+	return info, nil
+}
+
+// Inspect inspects path, a SavedModel directory or a frozen graph file.
+func Inspect(path string, tags []string) (*GraphInfo, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return InspectSavedModel(path, tags)
+	}
+	return InspectFrozenGraph(path)
+}
+
+// WriteText writes info as human readable tables.
+func (info *GraphInfo) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	specs := func(title string, specs []TensorSpec) {
+		fmt.Fprintf(tw, "%s:\n", title)
+		for _, spec := range specs {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", spec.Name, spec.DType, shapeString(spec.Shape))
+		}
+		fmt.Fprintln(tw)
+	}
+	specs("Placeholders", info.Placeholders)
+	specs("Candidate outputs", info.Outputs)
+
+	if len(info.Signatures) != 0 {
+		fmt.Fprintf(tw, "Signatures (tags %s):\n", strings.Join(info.Tags, ","))
+		writeSignatures(tw, info.Signatures)
+		fmt.Fprintln(tw)
+	}
+
+	types := make([]string, 0, len(info.Ops))
+	for t := range info.Ops {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if info.Ops[types[i]] != info.Ops[types[j]] {
+			return info.Ops[types[i]] > info.Ops[types[j]]
+		}
+		return types[i] < types[j]
+	})
+	fmt.Fprintf(tw, "Ops (%d):\n", info.NumOps)
+	for _, t := range types {
+		fmt.Fprintf(tw, "  %s\t%d\n", t, info.Ops[t])
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintf(tw, "Parameters: %d\n", info.Parameters)
+	return tw.Flush()
+}
+
+// WriteSignatures writes the signature defs sigs with their inputs and
+// outputs as a text table.
+func WriteSignatures(w io.Writer, sigs []Signature) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	writeSignatures(tw, sigs)
+	return tw.Flush()
+}
+
+func writeSignatures(w io.Writer, sigs []Signature) {
+	for _, sig := range sigs {
+		fmt.Fprintf(w, "  %s\t%s\n", sig.Key, sig.MethodName)
+		for _, spec := range sig.Inputs {
+			fmt.Fprintf(w, "    input %s\t%s\t%s\t%s\n", spec.Key, spec.Name, spec.DType, shapeString(spec.Shape))
+		}
+		for _, spec := range sig.Outputs {
+			fmt.Fprintf(w, "    output %s\t%s\t%s\t%s\n", spec.Key, spec.Name, spec.DType, shapeString(spec.Shape))
+		}
+	}
+}
+
+func shapeString(shape []int64) string {
+	if shape == nil {
+		return "unknown"
+	}
+	return fmt.Sprint(shape)
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	tfproto "github.com/tensorflow/tensorflow/tensorflow/go/core/protobuf"
+)
+
+func TestInspectSavedModelWithoutGraphDef(t *testing.T) {
+	dir, err := ioutil.TempDir("", "savedmodel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	saved := &tfproto.SavedModel{MetaGraphs: []*tfproto.MetaGraphDef{{
+		MetaInfoDef: &tfproto.MetaGraphDef_MetaInfoDef{Tags: []string{"serve"}},
+	}}}
+	b, err := proto.Marshal(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "saved_model.pb"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = InspectSavedModel(dir, []string{"serve"})
+	if err == nil || !strings.Contains(err.Error(), "meta graph has no graph_def") {
+		t.Errorf("InspectSavedModel error = %v, want no graph_def", err)
+	}
+	_, err = InspectSavedModel(dir, []string{"train"})
+	if err == nil || !strings.Contains(err.Error(), "no meta graph tagged {train}") {
+		t.Errorf("InspectSavedModel error = %v, want no meta graph tagged {train}", err)
+	}
+}
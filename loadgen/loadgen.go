@@ -0,0 +1,362 @@
+// Package loadgen benchmarks a model under the four scenarios of the MLPerf
+// inference load generator: SingleStream, MultiStream, Server and Offline.
+//
+// A query is a list of sample indexes into a sample library of
+// Settings.SampleCount samples; the system under test is a RunFunc that runs
+// inference on the samples of one query. Latencies are measured from the time
+// a query is scheduled to the time RunFunc returns.
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scenario selects how queries are issued.
+type Scenario string
+
+// The MLPerf scenarios.
+const (
+	// SingleStream issues queries of one sample, each after the previous one
+	// completes. The metric is the 90th percentile latency.
+	SingleStream Scenario = "SingleStream"
+	// MultiStream issues queries of SamplesPerQuery samples back to back. The
+	// metric is the 99th percentile latency.
+	MultiStream Scenario = "MultiStream"
+	// Server issues queries of one sample following a Poisson process of
+	// rate TargetQPS. The run is valid if the 99th percentile latency is
+	// within TargetLatency.
+	Server Scenario = "Server"
+	// Offline issues all samples as one query. The metric is the throughput
+	// in samples per second.
+	Offline Scenario = "Offline"
+)
+
+// ParseScenario returns the scenario called name, ignoring case.
+func ParseScenario(name string) (Scenario, error) {
+	for _, s := range []Scenario{SingleStream, MultiStream, Server, Offline} {
+		if strings.EqualFold(string(s), name) {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unknown scenario %q", name)
+}
+
+// RunFunc runs inference on the samples of one query.
+type RunFunc func(ctx context.Context, samples []int) error
+
+// Settings configures a run. Zero values take the defaults of MLPerf, except
+// for SampleCount which is required.
+type Settings struct {
+	Scenario Scenario
+	// SampleCount is the number of samples in the library.
+	SampleCount int
+	// SamplesPerQuery is the size of MultiStream queries, 8 by default.
+	SamplesPerQuery int
+	// TargetQPS is the arrival rate of Server queries. For Offline it sizes
+	// the query to last MinDuration; without it, a warm-up query of the
+	// whole library measures the throughput to size the query with.
+	TargetQPS float64
+	// MaxInFlight bounds the Server queries running at once, 128 by default.
+	// Arrivals past it wait for a query to complete, their wait counting in
+	// their latency.
+	MaxInFlight int
+	// TargetLatency bounds the latency percentile of Server and MultiStream
+	// runs. Zero disables the check.
+	TargetLatency time.Duration
+	// TargetLatencyPercentile is the percentile checked against
+	// TargetLatency, 0.99 by default.
+	TargetLatencyPercentile float64
+	// MinDuration and MinQueryCount are the minimum duration and number of
+	// queries of a valid run, 60s and 1024 queries by default.
+	MinDuration   time.Duration
+	MinQueryCount int
+	// Seed seeds sample selection and Server arrivals.
+	Seed int64
+}
+
+func (s Settings) withDefaults() Settings {
+	if s.SamplesPerQuery <= 0 {
+		s.SamplesPerQuery = 8
+	}
+	if s.TargetLatencyPercentile <= 0 {
+		s.TargetLatencyPercentile = 0.99
+	}
+	if s.MinDuration <= 0 {
+		s.MinDuration = 60 * time.Second
+	}
+	if s.MinQueryCount <= 0 {
+		s.MinQueryCount = 1024
+	}
+	if s.MaxInFlight <= 0 {
+		s.MaxInFlight = 128
+	}
+	if s.Scenario == Offline && s.MinQueryCount > 1 {
+		s.MinQueryCount = 1
+	}
+	return s
+}
+
+// Result holds the measurements of a run.
+type Result struct {
+	Settings Settings
+	// Latencies holds the latency of every completed query, sorted.
+	Latencies []time.Duration
+	// Queries and Samples count the completed queries and their samples.
+	Queries int
+	Samples int
+	// Errors counts the queries for which RunFunc failed.
+	Errors int
+	// Duration is the time from the first issued query to the last
+	// completed one.
+	Duration time.Duration
+	// FirstError is the first error returned by RunFunc.
+	FirstError error
+}
+
+// Run benchmarks run under settings. It stops early, returning the partial
+// result and the error of ctx, if ctx is done.
+func Run(ctx context.Context, run RunFunc, settings Settings) (*Result, error) {
+	settings = settings.withDefaults()
+	if settings.SampleCount <= 0 {
+		return nil, fmt.Errorf("the sample library is empty")
+	}
+	if settings.Scenario == Server && settings.TargetQPS <= 0 {
+		return nil, fmt.Errorf("the Server scenario needs a target QPS")
+	}
+
+	r := &recorder{
+		result: &Result{Settings: settings},
+		rng:    rand.New(rand.NewSource(settings.Seed)),
+	}
+	start := time.Now()
+	switch settings.Scenario {
+	case SingleStream:
+		r.stream(ctx, run, 1, start)
+	case MultiStream:
+		r.stream(ctx, run, settings.SamplesPerQuery, start)
+	case Server:
+		r.server(ctx, run, start)
+	case Offline:
+		r.offline(ctx, run, start)
+	default:
+		return nil, fmt.Errorf("unknown scenario %q", settings.Scenario)
+	}
+
+	res := r.result
+	sort.Slice(res.Latencies, func(i, j int) bool { return res.Latencies[i] < res.Latencies[j] })
+	return res, ctx.Err()
+}
+
+// recorder issues queries and collects their latencies.
+type recorder struct {
+	mu     sync.Mutex
+	result *Result
+	rng    *rand.Rand
+	last   time.Time
+}
+
+func (r *recorder) samples(n int) []int {
+	samples := make([]int, n)
+	for i := range samples {
+		samples[i] = r.rng.Intn(r.result.Settings.SampleCount)
+	}
+	return samples
+}
+
+// issue runs one query scheduled at scheduled and records its latency.
+func (r *recorder) issue(ctx context.Context, run RunFunc, samples []int, scheduled, start time.Time) {
+	err := run(ctx, samples)
+	end := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := r.result
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		res.Errors++
+		if res.FirstError == nil {
+			res.FirstError = err
+		}
+		return
+	}
+	res.Latencies = append(res.Latencies, end.Sub(scheduled))
+	res.Queries++
+	res.Samples += len(samples)
+	if end.After(r.last) {
+		r.last = end
+		res.Duration = end.Sub(start)
+	}
+}
+
+// done reports whether enough queries were issued since start.
+func (r *recorder) done(issued int, elapsed time.Duration) bool {
+	s := r.result.Settings
+	return issued >= s.MinQueryCount && elapsed >= s.MinDuration
+}
+
+func (r *recorder) stream(ctx context.Context, run RunFunc, samplesPerQuery int, start time.Time) {
+	for issued := 0; !r.done(issued, time.Since(start)) && ctx.Err() == nil; issued++ {
+		r.issue(ctx, run, r.samples(samplesPerQuery), time.Now(), start)
+	}
+}
+
+func (r *recorder) server(ctx context.Context, run RunFunc, start time.Time) {
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, r.result.Settings.MaxInFlight)
+	next := start
+	for issued := 0; !r.done(issued, next.Sub(start)); issued++ {
+		// Exponentially distributed gaps make Poisson arrivals.
+		gap := r.rng.ExpFloat64() / r.result.Settings.TargetQPS
+		next = next.Add(time.Duration(gap * float64(time.Second)))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			wg.Wait()
+			return
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func(samples []int, scheduled time.Time) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			r.issue(ctx, run, samples, scheduled, start)
+		}(r.samples(1), next)
+	}
+	wg.Wait()
+}
+
+func (r *recorder) offline(ctx context.Context, run RunFunc, start time.Time) {
+	s := r.result.Settings
+	if s.TargetQPS <= 0 {
+		// Measure the throughput on the library, which also warms the model
+		// up, and report it as the target.
+		warmup := make([]int, s.SampleCount)
+		for i := range warmup {
+			warmup[i] = i
+		}
+		begin := time.Now()
+		if err := run(ctx, warmup); err != nil {
+			if ctx.Err() == nil {
+				r.result.Errors++
+				r.result.FirstError = err
+			}
+			return
+		}
+		if elapsed := time.Since(begin); elapsed > 0 {
+			s.TargetQPS = float64(s.SampleCount) / elapsed.Seconds()
+			r.result.Settings.TargetQPS = s.TargetQPS
+		}
+		start = time.Now()
+	}
+	n := s.SampleCount
+	if s.TargetQPS > 0 {
+		// Enough samples to last MinDuration at the expected throughput, with
+		// a 10% margin like MLPerf.
+		want := int(math.Ceil(1.1 * s.TargetQPS * s.MinDuration.Seconds()))
+		if want > n {
+			n = want
+		}
+	}
+	samples := make([]int, n)
+	for i := range samples {
+		samples[i] = i % s.SampleCount
+	}
+	r.issue(ctx, run, samples, time.Now(), start)
+}
+
+// Percentile returns the latency below which a fraction p of the queries
+// completed, using the nearest rank.
+func (r *Result) Percentile(p float64) time.Duration {
+	n := len(r.Latencies)
+	if n == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(n))) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= n {
+		i = n - 1
+	}
+	return r.Latencies[i]
+}
+
+// Mean returns the mean latency.
+func (r *Result) Mean() time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	var sum time.Duration
+	for _, l := range r.Latencies {
+		sum += l
+	}
+	return sum / time.Duration(len(r.Latencies))
+}
+
+// QPS returns the completed queries per second.
+func (r *Result) QPS() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Queries) / r.Duration.Seconds()
+}
+
+// SamplesPerSecond returns the completed samples per second.
+func (r *Result) SamplesPerSecond() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Samples) / r.Duration.Seconds()
+}
+
+// MetricPercentile returns the latency percentile reported for the scenario.
+func (r *Result) MetricPercentile() float64 {
+	if r.Settings.Scenario == SingleStream {
+		return 0.90
+	}
+	return r.Settings.TargetLatencyPercentile
+}
+
+// MinDurationMet reports whether the run lasted long enough.
+func (r *Result) MinDurationMet() bool {
+	return r.Duration >= r.Settings.MinDuration
+}
+
+// MinQueriesMet reports whether enough queries completed.
+func (r *Result) MinQueriesMet() bool {
+	return r.Queries >= r.Settings.MinQueryCount
+}
+
+// LatencyMet reports whether the latency percentile is within the target
+// latency. It is always true without a target latency and for SingleStream
+// and Offline runs.
+func (r *Result) LatencyMet() bool {
+	s := r.Settings
+	if s.TargetLatency <= 0 || (s.Scenario != Server && s.Scenario != MultiStream) {
+		return true
+	}
+	return r.Percentile(s.TargetLatencyPercentile) <= s.TargetLatency
+}
+
+// Valid reports whether the run satisfies every constraint and had no errors.
+func (r *Result) Valid() bool {
+	return r.Errors == 0 && r.MinDurationMet() && r.MinQueriesMet() && r.LatencyMet()
+}
@@ -0,0 +1,114 @@
+package loadgen
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+const rule = "================================================"
+
+// WriteSummary writes the result in the layout of the mlperf_log_summary.txt
+// file of the MLPerf load generator. Latencies are in nanoseconds.
+func (r *Result) WriteSummary(w io.Writer, sutName string) error {
+	s := r.Settings
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	line := func(name string, value interface{}) {
+		fmt.Fprintf(tw, "%s\t: %v\n", name, value)
+	}
+	header := func(title string) {
+		tw.Flush()
+		fmt.Fprintf(w, "%s\n%s\n%s\n", rule, title, rule)
+	}
+
+	header("MLPerf Results Summary")
+	line("SUT name", sutName)
+	line("Scenario", s.Scenario)
+	line("Mode", "PerformanceOnly")
+	switch s.Scenario {
+	case SingleStream, MultiStream:
+		line(fmt.Sprintf("%s percentile latency (ns)", ordinal(r.MetricPercentile())), int64(r.Percentile(r.MetricPercentile())))
+	case Server:
+		line("Scheduled samples per second", fmt.Sprintf("%.2f", s.TargetQPS))
+	case Offline:
+		line("Samples per second", fmt.Sprintf("%.2f", r.SamplesPerSecond()))
+	}
+	line("Result is", validity(r.Valid()))
+	line("  Min duration satisfied", yesNo(r.MinDurationMet()))
+	line("  Min queries satisfied", yesNo(r.MinQueriesMet()))
+	if s.Scenario == Server || s.Scenario == MultiStream {
+		line("  Performance constraints satisfied", yesNo(r.LatencyMet()))
+	}
+	if r.Errors != 0 {
+		line("  Errors", fmt.Sprintf("%d (first: %v)", r.Errors, r.FirstError))
+	}
+	fmt.Fprintln(tw)
+
+	header("Additional Stats")
+	line("Completed queries", r.Queries)
+	line("Completed samples", r.Samples)
+	line("Completed queries per second", fmt.Sprintf("%.2f", r.QPS()))
+	line("Completed samples per second", fmt.Sprintf("%.2f", r.SamplesPerSecond()))
+	fmt.Fprintln(tw)
+	line("Min latency (ns)", int64(r.Percentile(0)))
+	line("Max latency (ns)", int64(r.Percentile(1)))
+	line("Mean latency (ns)", int64(r.Mean()))
+	for _, p := range []float64{0.50, 0.90, 0.95, 0.97, 0.99, 0.999} {
+		line(fmt.Sprintf("%.2f percentile latency (ns)", p*100), int64(r.Percentile(p)))
+	}
+	fmt.Fprintln(tw)
+
+	header("Test Parameters Used")
+	line("samples_per_query", r.samplesPerQuery())
+	line("target_qps", s.TargetQPS)
+	line("target_latency (ns)", int64(s.TargetLatency))
+	line("target_latency_percentile", s.TargetLatencyPercentile)
+	line("min_duration (ms)", int64(s.MinDuration/time.Millisecond))
+	line("min_query_count", s.MinQueryCount)
+	line("performance_sample_count", s.SampleCount)
+	line("qsl_rng_seed", s.Seed)
+	return tw.Flush()
+}
+
+// WriteSummaryFile writes the summary to path.
+func (r *Result) WriteSummaryFile(path, sutName string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := r.WriteSummary(f, sutName); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (r *Result) samplesPerQuery() int {
+	switch r.Settings.Scenario {
+	case MultiStream:
+		return r.Settings.SamplesPerQuery
+	case Offline:
+		return r.Samples
+	}
+	return 1
+}
+
+func ordinal(p float64) string {
+	return fmt.Sprintf("%gth", p*100)
+}
+
+func validity(ok bool) string {
+	if ok {
+		return "VALID"
+	}
+	return "INVALID"
+}
+
+func yesNo(ok bool) string {
+	if ok {
+		return "Yes"
+	}
+	return "NO"
+}
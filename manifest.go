@@ -0,0 +1,362 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// MANIFEST UTILITY FUNCTIONS
+
+// Resize policies understood by Preprocessing.
+const (
+	ResizeNone        = "none"
+	ResizeFixed       = "fixed"
+	ResizeLongestSide = "longest_side"
+)
+
+// TensorSpec describes one input or output of a model. Key is the name the
+// tensor is addressed by in Model.Run and defaults to Name, the tensor name in
+// the graph. Unknown dimensions in Shape are written as -1.
+type TensorSpec struct {
+	Key   string  `json:"key,omitempty" yaml:"key,omitempty"`
+	Name  string  `json:"name" yaml:"name"`
+	DType string  `json:"dtype,omitempty" yaml:"dtype,omitempty"`
+	Shape []int64 `json:"shape,omitempty" yaml:"shape,omitempty"`
+}
+
+// Preprocessing describes how an image is turned into an input tensor.
+// Pixels of float inputs are normalized as (value - mean) / scale.
+type Preprocessing struct {
+	Resize string    `json:"resize,omitempty" yaml:"resize,omitempty"`
+	Width  int       `json:"width,omitempty" yaml:"width,omitempty"`
+	Height int       `json:"height,omitempty" yaml:"height,omitempty"`
+	Size   int       `json:"size,omitempty" yaml:"size,omitempty"`
+	Mean   []float32 `json:"mean,omitempty" yaml:"mean,omitempty"`
+	Scale  float32   `json:"scale,omitempty" yaml:"scale,omitempty"`
+}
+
+// Manifest declares everything needed to run a model: where the graph is, its
+// inputs and outputs, how images are preprocessed and where the labels are.
+// The graph is resolved against the model directory given to Load, the labels
+// against the directory of the manifest. SavedModels may name a Signature
+// instead of listing their inputs and outputs.
+type Manifest struct {
+	Name          string        `json:"name" yaml:"name"`
+	Task          string        `json:"task,omitempty" yaml:"task,omitempty"`
+	Format        string        `json:"format,omitempty" yaml:"format,omitempty"`
+	Graph         string        `json:"graph" yaml:"graph"`
+	Tags          []string      `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Signature     string        `json:"signature,omitempty" yaml:"signature,omitempty"`
+	Inputs        []TensorSpec  `json:"inputs" yaml:"inputs"`
+	Outputs       []TensorSpec  `json:"outputs" yaml:"outputs"`
+	Preprocessing Preprocessing `json:"preprocessing,omitempty" yaml:"preprocessing,omitempty"`
+	Labels        string        `json:"labels,omitempty" yaml:"labels,omitempty"`
+
+	dir string
+}
+
+// LoadManifest reads a manifest from a JSON file (.json) or a YAML file (any
+// other extension).
+func LoadManifest(path string) (*Manifest, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{}
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		err = json.Unmarshal(b, m)
+	} else {
+		err = yaml.Unmarshal(b, m)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %v", path, err)
+	}
+	m.dir = filepath.Dir(path)
+
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("manifest %s: %v", path, err)
+	}
+	return m, nil
+}
+
+// Validate checks that the manifest is complete and fills in defaults.
+func (m *Manifest) Validate() error {
+	if m.Graph == "" {
+		return fmt.Errorf("no graph file given")
+	}
+	switch m.Format {
+	case "":
+		m.Format = "frozen"
+	case "frozen", "saved_model":
+	default:
+		return fmt.Errorf("unknown format %q", m.Format)
+	}
+	if m.Signature != "" && m.Format != "saved_model" {
+		return fmt.Errorf("signature %q needs format saved_model", m.Signature)
+	}
+	if len(m.Outputs) == 0 && m.Signature == "" {
+		return fmt.Errorf("no outputs given")
+	}
+	for _, specs := range [][]TensorSpec{m.Inputs, m.Outputs} {
+		for i := range specs {
+			if specs[i].Name == "" {
+				return fmt.Errorf("tensor without a name")
+			}
+			if specs[i].Key == "" {
+				specs[i].Key = specs[i].Name
+			}
+			if specs[i].DType != "" {
+				if _, err := ParseDataType(specs[i].DType); err != nil {
+					return fmt.Errorf("tensor %q: %v", specs[i].Key, err)
+				}
+			}
+		}
+	}
+	switch m.Preprocessing.Resize {
+	case "", ResizeNone:
+	case ResizeFixed:
+		if m.Preprocessing.Width <= 0 || m.Preprocessing.Height <= 0 {
+			return fmt.Errorf("resize %q needs width and height", ResizeFixed)
+		}
+	case ResizeLongestSide:
+		if m.Preprocessing.Size <= 0 {
+			return fmt.Errorf("resize %q needs size", ResizeLongestSide)
+		}
+	default:
+		return fmt.Errorf("unknown resize policy %q", m.Preprocessing.Resize)
+	}
+	if n := len(m.Preprocessing.Mean); n != 0 && n != 3 {
+		return fmt.Errorf("preprocessing.mean has %d values, want 3, one per channel", n)
+	}
+	if m.Preprocessing.Scale < 0 {
+		return fmt.Errorf("preprocessing.scale %v is negative", m.Preprocessing.Scale)
+	}
+	return nil
+}
+
+// Path resolves file against dir, or against the directory holding the
+// manifest when dir is empty.
+func (m *Manifest) Path(dir, file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	if dir == "" {
+		dir = m.dir
+	}
+	return filepath.Join(dir, file)
+}
+
+// Input returns the input declared as key.
+func (m *Manifest) Input(key string) (TensorSpec, bool) {
+	return findSpec(m.Inputs, key)
+}
+
+// Output returns the output declared as key.
+func (m *Manifest) Output(key string) (TensorSpec, bool) {
+	return findSpec(m.Outputs, key)
+}
+
+// mergeSpecs appends the specs of extra whose key is not declared in specs.
+func mergeSpecs(specs, extra []TensorSpec) []TensorSpec {
+	for _, spec := range extra {
+		if _, ok := findSpec(specs, spec.Key); !ok {
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
+
+func findSpec(specs []TensorSpec, key string) (TensorSpec, bool) {
+	for _, spec := range specs {
+		if spec.Key == key {
+			return spec, true
+		}
+	}
+	return TensorSpec{}, false
+}
+
+// Load loads the graph of the manifest from dir and checks that the declared
+// dtypes and shapes agree with the graph. The inputs and outputs of the
+// signature, if any, are added to those declared by the manifest.
+func (m *Manifest) Load(dir string, options *tf.SessionOptions) (*Model, error) {
+	path := m.Path(dir, m.Graph)
+	if m.Signature != "" {
+		sig, err := ReadSignature(path, m.Tags, m.Signature)
+		if err != nil {
+			return nil, err
+		}
+		m.Inputs = mergeSpecs(m.Inputs, sig.Inputs)
+		m.Outputs = mergeSpecs(m.Outputs, sig.Outputs)
+	}
+
+	inputs := make(map[string]string, len(m.Inputs))
+	for _, spec := range m.Inputs {
+		inputs[spec.Key] = spec.Name
+	}
+	outputs := make(map[string]string, len(m.Outputs))
+	for _, spec := range m.Outputs {
+		outputs[spec.Key] = spec.Name
+	}
+
+	var (
+		model *Model
+		err   error
+	)
+	if m.Format == "saved_model" {
+		model, err = LoadSavedModel(path, m.Tags, inputs, outputs, options)
+	} else {
+		model, err = LoadFrozenModel(path, inputs, outputs, options)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, spec := range m.Inputs {
+		output, _ := model.Input(spec.Key)
+		if err := spec.check(output); err != nil {
+			model.Close()
+			return nil, fmt.Errorf("%s: input %q: %v", path, spec.Key, err)
+		}
+	}
+	for _, spec := range m.Outputs {
+		output, _ := model.Output(spec.Key)
+		if err := spec.check(output); err != nil {
+			model.Close()
+			return nil, fmt.Errorf("%s: output %q: %v", path, spec.Key, err)
+		}
+	}
+	return model, nil
+}
+
+// LoadLabels reads the label file of the manifest. Labels ship with the
+// manifest, so the file is resolved against the manifest directory.
+func (m *Manifest) LoadLabels() ([]string, error) {
+	if m.Labels == "" {
+		return nil, nil
+	}
+	return ReadLabels(m.Path("", m.Labels))
+}
+
+// check compares the declared dtype and shape with the static ones in the graph.
+func (s TensorSpec) check(output tf.Output) error {
+	if s.DType != "" {
+		dtype, _ := ParseDataType(s.DType)
+		if dtype != output.DataType() {
+			return fmt.Errorf("declared as %s but graph has %s", s.DType, DataTypeName(output.DataType()))
+		}
+	}
+
+	shape := output.Shape()
+	if s.Shape == nil || shape.NumDimensions() < 0 {
+		return nil
+	}
+	if shape.NumDimensions() != len(s.Shape) {
+		return fmt.Errorf("declared shape %v but graph has %v", s.Shape, shape)
+	}
+	for i, dim := range s.Shape {
+		if size := shape.Size(i); dim >= 0 && size >= 0 && dim != size {
+			return fmt.Errorf("declared shape %v but graph has %v", s.Shape, shape)
+		}
+	}
+	return nil
+}
+
+var dataTypes = map[string]tf.DataType{
+	"float32": tf.Float,
+	"float64": tf.Double,
+	"int8":    tf.Int8,
+	"int16":   tf.Int16,
+	"int32":   tf.Int32,
+	"int64":   tf.Int64,
+	"uint8":   tf.Uint8,
+	"uint16":  tf.Uint16,
+	"string":  tf.String,
+	"bool":    tf.Bool,
+}
+
+// ParseDataType converts a dtype name such as "float32" or "uint8" to a
+// tf.DataType.
+func ParseDataType(name string) (tf.DataType, error) {
+	dtype, ok := dataTypes[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown dtype %q", name)
+	}
+	return dtype, nil
+}
+
+// DataTypeName is the inverse of ParseDataType.
+func DataTypeName(dtype tf.DataType) string {
+	for name, t := range dataTypes {
+		if t == dtype {
+			return name
+		}
+	}
+	return fmt.Sprintf("dtype(%d)", int(dtype))
+}
+
+// IMAGE PREPROCESSING
+
+// Apply resizes img according to the resize policy.
+func (p Preprocessing) Apply(img image.Image) image.Image {
+	switch p.Resize {
+	case ResizeFixed:
+		return imaging.Resize(img, p.Width, p.Height, imaging.Linear)
+	case ResizeLongestSide:
+		width, height := img.Bounds().Dx(), img.Bounds().Dy()
+		ratio := float32(p.Size) / float32(max(width, height))
+		return imaging.Resize(img, int(ratio*float32(width)), int(ratio*float32(height)), imaging.Linear)
+	}
+	return img
+}
+
+// Tensor resizes img and converts it into a batch of one image of type
+// dtype. Float images are normalized with Mean and Scale.
+func (p Preprocessing) Tensor(img image.Image, dtype tf.DataType) (*tf.Tensor, error) {
+	resized := imaging.Clone(p.Apply(img))
+	height, width := resized.Bounds().Dy(), resized.Bounds().Dx()
+
+	switch dtype {
+	case tf.Uint8:
+		return ImageTensorUint8(resized)
+	case tf.Float:
+		mean := p.Mean
+		if mean == nil {
+			mean = []float32{0, 0, 0}
+		}
+		scale := p.Scale
+		if scale == 0 {
+			scale = 1
+		}
+		imgFloats, err := NormalizeImageHWC(resized, mean, scale)
+		if err != nil {
+			return nil, err
+		}
+		return ReshapeTensorFloats([][]float32{imgFloats}, []int64{1, int64(height), int64(width), 3})
+	}
+	return nil, fmt.Errorf("cannot make an image tensor of type %s", DataTypeName(dtype))
+}
+
+// ImageTensorUint8 converts img into a [1, height, width, 3] uint8 tensor.
+func ImageTensorUint8(in *image.NRGBA) (*tf.Tensor, error) {
+	height := in.Bounds().Dy()
+	width := in.Bounds().Dx()
+	out := make([][][]uint8, height)
+	for y := 0; y < height; y++ {
+		row := make([][]uint8, width)
+		for x := 0; x < width; x++ {
+			nrgba := in.NRGBAAt(x, y)
+			row[x] = []uint8{nrgba.R, nrgba.G, nrgba.B}
+		}
+		out[y] = row
+	}
+	return tf.NewTensor([][][][]uint8{out})
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestManifestValidate(t *testing.T) {
+	valid := func() Manifest {
+		return Manifest{
+			Graph:   "model.pb",
+			Inputs:  []TensorSpec{{Key: "image", Name: "input:0", DType: "float32"}},
+			Outputs: []TensorSpec{{Name: "output:0"}},
+		}
+	}
+	tests := []struct {
+		name   string
+		modify func(m *Manifest)
+		want   string
+	}{
+		{"valid", func(m *Manifest) {}, ""},
+		{"mean and scale", func(m *Manifest) {
+			m.Preprocessing.Mean = []float32{127.5, 127.5, 127.5}
+			m.Preprocessing.Scale = 127.5
+		}, ""},
+		{"saved model signature", func(m *Manifest) {
+			m.Format, m.Signature, m.Outputs = "saved_model", "serving_default", nil
+		}, ""},
+		{"no graph", func(m *Manifest) { m.Graph = "" }, "no graph file"},
+		{"unknown format", func(m *Manifest) { m.Format = "onnx" }, "unknown format"},
+		{"signature of a frozen graph", func(m *Manifest) { m.Signature = "serving_default" }, "needs format saved_model"},
+		{"no outputs", func(m *Manifest) { m.Outputs = nil }, "no outputs"},
+		{"tensor without a name", func(m *Manifest) { m.Inputs[0].Name = "" }, "without a name"},
+		{"unknown dtype", func(m *Manifest) { m.Inputs[0].DType = "complex" }, "tensor \"image\""},
+		{"fixed without size", func(m *Manifest) { m.Preprocessing.Resize = ResizeFixed }, "needs width and height"},
+		{"longest side without size", func(m *Manifest) { m.Preprocessing.Resize = ResizeLongestSide }, "needs size"},
+		{"unknown resize", func(m *Manifest) { m.Preprocessing.Resize = "crop" }, "unknown resize"},
+		{"one mean", func(m *Manifest) { m.Preprocessing.Mean = []float32{127.5} }, "preprocessing.mean has 1 values"},
+		{"four means", func(m *Manifest) { m.Preprocessing.Mean = []float32{1, 2, 3, 4} }, "preprocessing.mean has 4 values"},
+		{"negative scale", func(m *Manifest) { m.Preprocessing.Scale = -1 }, "preprocessing.scale"},
+	}
+	for _, tt := range tests {
+		m := valid()
+		tt.modify(&m)
+		err := m.Validate()
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%s: Validate: %v", tt.name, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%s: Validate error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	m := Manifest{Graph: "model.pb", Outputs: []TensorSpec{{Name: "output:0"}}}
+	if err := m.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if m.Format != "frozen" || m.Outputs[0].Key != "output:0" {
+		t.Errorf("Validate defaults: format %q, key %q", m.Format, m.Outputs[0].Key)
+	}
+}
@@ -0,0 +1,323 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// MODEL UTILITY FUNCTIONS
+
+// Model bundles a graph, the session used to run it and the named inputs and
+// outputs resolved from the graph. Keys of the input and output maps are the
+// names used by Run, values are tensor names in the graph ("op" or "op:index").
+type Model struct {
+	Graph   *tf.Graph
+	Session *tf.Session
+
+	inputs  map[string]tf.Output
+	outputs map[string]tf.Output
+	fetches []string
+	batcher *Batcher
+	pool    *SessionPool
+	profile *Profile
+	// savedModel is set for SavedModels, whose variables only live in
+	// Session.
+	savedModel bool
+}
+
+// Names maps each tensor name to itself, for models whose inputs and outputs are
+// addressed by their graph names.
+func Names(names ...string) map[string]string {
+	m := make(map[string]string, len(names))
+	for _, name := range names {
+		m[name] = name
+	}
+	return m
+}
+
+// NewModel resolves inputs and outputs in graph and returns a Model running on
+// session. It fails if any of the tensors does not exist in the graph.
+func NewModel(graph *tf.Graph, session *tf.Session, inputs, outputs map[string]string) (*Model, error) {
+	m := &Model{
+		Graph:   graph,
+		Session: session,
+		inputs:  make(map[string]tf.Output, len(inputs)),
+		outputs: make(map[string]tf.Output, len(outputs)),
+	}
+	for key, name := range inputs {
+		output, err := LookupTensor(graph, name)
+		if err != nil {
+			return nil, fmt.Errorf("input %q: %v", key, err)
+		}
+		m.inputs[key] = output
+	}
+	for key, name := range outputs {
+		output, err := LookupTensor(graph, name)
+		if err != nil {
+			return nil, fmt.Errorf("output %q: %v", key, err)
+		}
+		m.outputs[key] = output
+		m.fetches = append(m.fetches, key)
+	}
+	sort.Strings(m.fetches)
+	return m, nil
+}
+
+// LoadFrozenModel imports the frozen GraphDef stored at path and creates a
+// session for it.
+func LoadFrozenModel(path string, inputs, outputs map[string]string, options *tf.SessionOptions) (*Model, error) {
+	def, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkGraphDef(def); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	// Construct an in-memory graph from the serialized form.
+	graph := tf.NewGraph()
+	if err := graph.Import(def, ""); err != nil {
+		return nil, fmt.Errorf("failed to import %s: %v", path, err)
+	}
+
+	// Create a session for inference over graph.
+	session, err := tf.NewSession(graph, options)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := NewModel(graph, session, inputs, outputs)
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return m, nil
+}
+
+// LoadSavedModel loads the SavedModel in dir tagged with tags.
+func LoadSavedModel(dir string, tags []string, inputs, outputs map[string]string, options *tf.SessionOptions) (*Model, error) {
+	if err := checkSavedModelOps(dir, tags); err != nil {
+		return nil, fmt.Errorf("%s: %v", dir, err)
+	}
+	saved, err := tf.LoadSavedModel(dir, tags, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load saved model %s: %v", dir, err)
+	}
+
+	m, err := NewModel(saved.Graph, saved.Session, inputs, outputs)
+	if err != nil {
+		saved.Session.Close()
+		return nil, fmt.Errorf("%s: %v", dir, err)
+	}
+	m.savedModel = true
+	return m, nil
+}
+
+// LookupTensor returns the output of graph named name, which is either an
+// operation name or "op:index".
+func LookupTensor(graph *tf.Graph, name string) (tf.Output, error) {
+	opName, index, err := ParseTensorName(name)
+	if err != nil {
+		return tf.Output{}, err
+	}
+	op := graph.Operation(opName)
+	if op == nil {
+		return tf.Output{}, fmt.Errorf("operation %q not found in graph", opName)
+	}
+	if index >= op.NumOutputs() {
+		return tf.Output{}, fmt.Errorf("operation %q has %d outputs, %q requested", opName, op.NumOutputs(), name)
+	}
+	return op.Output(index), nil
+}
+
+// ParseTensorName splits a tensor name of the form "op:index" into its
+// operation name and output index. The index defaults to 0.
+func ParseTensorName(name string) (string, int, error) {
+	i := strings.LastIndex(name, ":")
+	if i < 0 {
+		return name, 0, nil
+	}
+	index, err := strconv.Atoi(name[i+1:])
+	if err != nil || index < 0 {
+		return "", 0, fmt.Errorf("invalid tensor name %q", name)
+	}
+	return name[:i], index, nil
+}
+
+// Placeholders returns the outputs of every Placeholder operation of graph,
+// sorted by name. These are the tensors a graph must be fed with.
+func Placeholders(graph *tf.Graph) []tf.Output {
+	var placeholders []tf.Output
+	ops := graph.Operations()
+	for i := range ops {
+		if ops[i].Type() == "Placeholder" {
+			placeholders = append(placeholders, ops[i].Output(0))
+		}
+	}
+	sort.Slice(placeholders, func(i, j int) bool {
+		return placeholders[i].Op.Name() < placeholders[j].Op.Name()
+	})
+	return placeholders
+}
+
+// Inputs returns the sorted names of the inputs of the model.
+func (m *Model) Inputs() []string {
+	keys := make([]string, 0, len(m.inputs))
+	for key := range m.inputs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Outputs returns the sorted names of the outputs of the model.
+func (m *Model) Outputs() []string {
+	return append([]string(nil), m.fetches...)
+}
+
+// Input returns the graph output fed by the input named key.
+func (m *Model) Input(key string) (tf.Output, bool) {
+	output, ok := m.inputs[key]
+	return output, ok
+}
+
+// Output returns the graph output fetched as key.
+func (m *Model) Output(key string) (tf.Output, bool) {
+	output, ok := m.outputs[key]
+	return output, ok
+}
+
+// UsePool runs the model on a pool of sessions including Session, see
+// SessionPool. Extra sessions are created with sessionOptions. It must be
+// called before the model is shared. SavedModels can only use pools of one
+// session, their variables being restored into Session alone.
+func (m *Model) UsePool(sessionOptions *tf.SessionOptions, options PoolOptions) error {
+	if m.savedModel && options.Sessions > 1 {
+		return fmt.Errorf("a saved model runs on a pool of one session, not %d: the variables are not restored into the others", options.Sessions)
+	}
+	pool, err := NewSessionPool(m.Graph, m.Session, sessionOptions, options)
+	if err != nil {
+		return err
+	}
+	if m.pool != nil {
+		m.pool.Close()
+	}
+	m.pool = pool
+	return nil
+}
+
+// Pool returns the session pool of the model, or nil if it has none.
+func (m *Model) Pool() *SessionPool {
+	return m.pool
+}
+
+// EnableProfiling traces every following run of the model into the returned
+// profile, see RunWithTrace. Traced runs bypass the session pool.
+func (m *Model) EnableProfiling() *Profile {
+	m.profile = NewProfile(m.Graph)
+	return m.profile
+}
+
+// Profile returns the profile of the model, or nil if profiling is not
+// enabled.
+func (m *Model) Profile() *Profile {
+	return m.profile
+}
+
+// Batching reports whether Run batches concurrent calls.
+func (m *Model) Batching() bool {
+	return m.batcher != nil
+}
+
+// EnableBatching makes Run batch concurrent calls, see Batcher. It must be
+// called before the model is shared.
+func (m *Model) EnableBatching(options BatchOptions) {
+	if m.batcher != nil {
+		m.batcher.Close()
+	}
+	m.batcher = NewBatcher(m.run, options)
+}
+
+// Run feeds the named input tensors and returns every output of the model
+// keyed by name.
+func (m *Model) Run(feeds map[string]*tf.Tensor) (map[string]*tf.Tensor, error) {
+	return m.RunContext(context.Background(), feeds)
+}
+
+// RunContext is like Run but returns early with the error of ctx if ctx is
+// done first.
+func (m *Model) RunContext(ctx context.Context, feeds map[string]*tf.Tensor) (map[string]*tf.Tensor, error) {
+	if m.batcher != nil {
+		return m.batcher.Run(ctx, feeds)
+	}
+	return m.run(ctx, feeds)
+}
+
+func (m *Model) run(ctx context.Context, feeds map[string]*tf.Tensor) (map[string]*tf.Tensor, error) {
+	inputs := make(map[tf.Output]*tf.Tensor, len(feeds))
+	for key, tensor := range feeds {
+		input, ok := m.inputs[key]
+		if !ok {
+			return nil, fmt.Errorf("model has no input named %q", key)
+		}
+		inputs[input] = tensor
+	}
+
+	fetches := make([]tf.Output, len(m.fetches))
+	for i, key := range m.fetches {
+		fetches[i] = m.outputs[key]
+	}
+
+	output, err := m.RunGraph(ctx, inputs, fetches)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]*tf.Tensor, len(output))
+	for i, key := range m.fetches {
+		results[key] = output[i]
+	}
+	return results, nil
+}
+
+// RunGraph runs arbitrary tensors of the graph on the sessions of the model,
+// bypassing batching. Profiled runs are traced on the session of the model
+// rather than on the pool, and are not interrupted once started.
+func (m *Model) RunGraph(ctx context.Context, feeds map[tf.Output]*tf.Tensor, fetches []tf.Output) ([]*tf.Tensor, error) {
+	if m.profile != nil {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		outputs, stats, err := RunWithTrace(m.Session, feeds, fetches, nil)
+		if err != nil {
+			return nil, err
+		}
+		m.profile.Add(stats)
+		return outputs, nil
+	}
+	if m.pool != nil {
+		return m.pool.Run(ctx, feeds, fetches, nil)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.Session.Run(feeds, fetches, nil)
+}
+
+// Close releases the sessions owned by the model.
+func (m *Model) Close() error {
+	if m.batcher != nil {
+		m.batcher.Close()
+	}
+	if m.pool != nil {
+		m.pool.Close()
+	}
+	return m.Session.Close()
+}
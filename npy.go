@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// NPY FILES
+
+// npyMagic starts every .npy file.
+const npyMagic = "\x93NUMPY"
+
+// npyTypes maps the numeric tensor types to their numpy descriptors. Tensor
+// contents are little-endian, like the descriptors.
+var npyTypes = map[tf.DataType]string{
+	tf.Float:  "<f4",
+	tf.Double: "<f8",
+	tf.Int8:   "|i1",
+	tf.Int16:  "<i2",
+	tf.Int32:  "<i4",
+	tf.Int64:  "<i8",
+	tf.Uint8:  "|u1",
+	tf.Uint16: "<u2",
+	tf.Bool:   "|b1",
+}
+
+// WriteNPY writes t to w in the .npy format of numpy, version 1.0. Only
+// numeric and boolean tensors can be written.
+func WriteNPY(w io.Writer, t *tf.Tensor) error {
+	descr, ok := npyTypes[t.DataType()]
+	if !ok {
+		return fmt.Errorf("cannot write %s tensors as npy", DataTypeName(t.DataType()))
+	}
+	dims := make([]string, len(t.Shape()))
+	for i, d := range t.Shape() {
+		dims[i] = strconv.FormatInt(d, 10)
+	}
+	shape := strings.Join(dims, ", ")
+	if len(dims) == 1 {
+		shape += ","
+	}
+	header := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': (%s), }", descr, shape)
+	// The header is padded with spaces and a newline so that the data starts
+	// at a multiple of 64 bytes.
+	pad := 64 - (len(npyMagic)+4+len(header)+1)%64
+	header += strings.Repeat(" ", pad%64) + "\n"
+
+	var prefix bytes.Buffer
+	prefix.WriteString(npyMagic)
+	prefix.Write([]byte{1, 0})
+	binary.Write(&prefix, binary.LittleEndian, uint16(len(header)))
+	prefix.WriteString(header)
+	if _, err := w.Write(prefix.Bytes()); err != nil {
+		return err
+	}
+	_, err := t.WriteContentsTo(w)
+	return err
+}
+
+var (
+	npyDescr = regexp.MustCompile(`'descr'\s*:\s*'([^']*)'`)
+	npyOrder = regexp.MustCompile(`'fortran_order'\s*:\s*(True|False)`)
+	npyShape = regexp.MustCompile(`'shape'\s*:\s*\(([^)]*)\)`)
+)
+
+// ReadNPY reads a tensor in the .npy format of numpy from r. Arrays must be
+// stored in C order with one of the little-endian types WriteNPY writes.
+func ReadNPY(r io.Reader) (*tf.Tensor, error) {
+	br := bufio.NewReader(r)
+	prefix := make([]byte, len(npyMagic)+2)
+	if _, err := io.ReadFull(br, prefix); err != nil {
+		return nil, fmt.Errorf("npy: %v", err)
+	}
+	if string(prefix[:len(npyMagic)]) != npyMagic {
+		return nil, fmt.Errorf("npy: bad magic string")
+	}
+	var headerLen int
+	switch major := prefix[len(npyMagic)]; major {
+	case 1:
+		var n uint16
+		if err := binary.Read(br, binary.LittleEndian, &n); err != nil {
+			return nil, fmt.Errorf("npy: %v", err)
+		}
+		headerLen = int(n)
+	case 2, 3:
+		var n uint32
+		if err := binary.Read(br, binary.LittleEndian, &n); err != nil {
+			return nil, fmt.Errorf("npy: %v", err)
+		}
+		headerLen = int(n)
+	default:
+		return nil, fmt.Errorf("npy: unsupported version %d", major)
+	}
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("npy: %v", err)
+	}
+
+	descr := npyDescr.FindSubmatch(header)
+	order := npyOrder.FindSubmatch(header)
+	shape := npyShape.FindSubmatch(header)
+	if descr == nil || order == nil || shape == nil {
+		return nil, fmt.Errorf("npy: invalid header %q", header)
+	}
+	if string(order[1]) == "True" {
+		return nil, fmt.Errorf("npy: fortran order arrays are not supported")
+	}
+	dataType, ok := npyDataType(string(descr[1]))
+	if !ok {
+		return nil, fmt.Errorf("npy: unsupported type %q", descr[1])
+	}
+	var dims []int64
+	for _, s := range strings.Split(string(shape[1]), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		d, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("npy: invalid shape (%s)", shape[1])
+		}
+		dims = append(dims, d)
+	}
+	return tf.ReadTensor(dataType, dims, br)
+}
+
+// npyDataType returns the tensor type of a numpy descriptor. Single byte
+// types may use any byte order character.
+func npyDataType(descr string) (tf.DataType, bool) {
+	for dt, d := range npyTypes {
+		if d == descr || d[0] == '|' && len(descr) == 3 && descr[1:] == d[1:] {
+			return dt, true
+		}
+	}
+	return 0, false
+}
+
+// WriteNPZ writes tensors to an .npz archive at path, one "key.npy" array
+// per tensor, as numpy.savez_compressed does. Arrays are written in the
+// order of their keys, so the same tensors always make the same archive.
+func WriteNPZ(path string, tensors map[string]*tf.Tensor) error {
+	keys := make([]string, 0, len(tensors))
+	for key := range tensors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, key := range keys {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: key + ".npy", Method: zip.Deflate})
+		if err != nil {
+			return err
+		}
+		if err := WriteNPY(w, tensors[key]); err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// ReadNPZ reads the arrays of an .npz archive at path, keyed by their names
+// without the .npy extension, like numpy.load does.
+func ReadNPZ(path string) (map[string]*tf.Tensor, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	tensors := make(map[string]*tf.Tensor, len(zr.File))
+	for _, f := range zr.File {
+		if !strings.HasSuffix(f.Name, ".npy") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		t, err := ReadNPY(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", path, f.Name, err)
+		}
+		tensors[strings.TrimSuffix(f.Name, ".npy")] = t
+	}
+	return tensors, nil
+}
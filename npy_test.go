@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+func TestNPYRoundTrip(t *testing.T) {
+	tests := []struct {
+		value  interface{}
+		header string
+	}{
+		{[]float32{1.5, -2}, "{'descr': '<f4', 'fortran_order': False, 'shape': (2,), }"},
+		{[][]int32{{1, 2, 3}, {4, 5, 6}}, "{'descr': '<i4', 'fortran_order': False, 'shape': (2, 3), }"},
+		{int64(7), "{'descr': '<i8', 'fortran_order': False, 'shape': (), }"},
+		{[]uint8{0, 255}, "{'descr': '|u1', 'fortran_order': False, 'shape': (2,), }"},
+		{[]bool{true, false}, "{'descr': '|b1', 'fortran_order': False, 'shape': (2,), }"},
+		{[][][]float64{{{1}, {2}}}, "{'descr': '<f8', 'fortran_order': False, 'shape': (1, 2, 1), }"},
+	}
+	for _, tt := range tests {
+		tensor, err := tf.NewTensor(tt.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := WriteNPY(&buf, tensor); err != nil {
+			t.Fatalf("WriteNPY(%v): %v", tt.value, err)
+		}
+		b := buf.Bytes()
+
+		// The header is that of numpy.save, padded so that the data
+		// starts at a multiple of 64 bytes.
+		n := int(binary.LittleEndian.Uint16(b[8:10]))
+		if !bytes.HasPrefix(b, []byte(npyMagic+"\x01\x00")) || (10+n)%64 != 0 {
+			t.Errorf("WriteNPY(%v) starts with %q", tt.value, b[:10])
+		}
+		if header := strings.TrimRight(string(b[10:10+n]), " \n"); header != tt.header {
+			t.Errorf("WriteNPY(%v) header = %q, want %q", tt.value, header, tt.header)
+		}
+
+		read, err := ReadNPY(&buf)
+		if err != nil {
+			t.Fatalf("ReadNPY(%v): %v", tt.value, err)
+		}
+		if !reflect.DeepEqual(read.Value(), tt.value) {
+			t.Errorf("ReadNPY = %v, want %v", read.Value(), tt.value)
+		}
+	}
+}
+
+func TestReadNPYErrors(t *testing.T) {
+	header := func(h string) string {
+		return npyMagic + "\x01\x00" + string([]byte{byte(len(h)), 0}) + h
+	}
+	tests := []struct{ name, npy, want string }{
+		{"magic", "\x93NUMPX\x01\x00", "bad magic"},
+		{"version", npyMagic + "\x04\x00", "unsupported version"},
+		{"header", header("{'descr': '<f4'}"), "invalid header"},
+		{"fortran", header("{'descr': '<f4', 'fortran_order': True, 'shape': (2,), }"), "fortran order"},
+		{"type", header("{'descr': '<c8', 'fortran_order': False, 'shape': (2,), }"), "unsupported type"},
+		{"shape", header("{'descr': '<f4', 'fortran_order': False, 'shape': (-1,), }"), "invalid shape"},
+	}
+	for _, tt := range tests {
+		_, err := ReadNPY(strings.NewReader(tt.npy))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: ReadNPY error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestNPZRoundTrip(t *testing.T) {
+	a, err := tf.NewTensor([]int32{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := tf.NewTensor([][]float32{{0.5}, {0.25}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "npz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "arrays.npz")
+	if err := WriteNPZ(path, map[string]*tf.Tensor{"a": a, "b": b}); err != nil {
+		t.Fatal(err)
+	}
+	tensors, err := ReadNPZ(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tensors) != 2 {
+		t.Fatalf("ReadNPZ read %d arrays, want 2", len(tensors))
+	}
+	if !reflect.DeepEqual(tensors["a"].Value(), a.Value()) || !reflect.DeepEqual(tensors["b"].Value(), b.Value()) {
+		t.Errorf("ReadNPZ = a: %v, b: %v", tensors["a"].Value(), tensors["b"].Value())
+	}
+}
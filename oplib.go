@@ -0,0 +1,168 @@
+package utils
+
+// #include <stdlib.h>
+// #include "tensorflow/c/c_api.h"
+import "C"
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unsafe"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tensorflow/tensorflow/tensorflow/go/core/framework"
+)
+
+// OP LIBRARIES
+
+// OpLibrary is a shared library of custom ops loaded into TensorFlow.
+type OpLibrary struct {
+	Path string
+	// Ops are the sorted names of the ops registered by the library.
+	Ops []string
+}
+
+// Libraries defining ops that graphs of the examples use but that are not
+// part of the core of TensorFlow.
+var opLibraryHints = map[string]string{
+	"GatherTree": "_beam_search_ops.so",
+	"Resampler":  "_resampler_ops.so",
+}
+
+// LoadOpLibrary loads the shared library at path and registers its ops and
+// kernels with TensorFlow, for graphs that need ops of tf.contrib or custom
+// ops. Loading the same library twice is harmless.
+func LoadOpLibrary(path string) (*OpLibrary, error) {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+	status := C.TF_NewStatus()
+	defer C.TF_DeleteStatus(status)
+
+	lib := C.TF_LoadLibrary(cPath, status)
+	if C.TF_GetCode(status) != C.TF_OK {
+		return nil, fmt.Errorf("failed to load op library %s: %s", path, C.GoString(C.TF_Message(status)))
+	}
+
+	// The op list is owned by the library handle, which stays loaded.
+	buf := C.TF_GetOpList(lib)
+	ops, err := opNames(C.GoBytes(buf.data, C.int(buf.length)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the ops of %s: %v", path, err)
+	}
+	return &OpLibrary{Path: path, Ops: ops}, nil
+}
+
+// LoadOpLibraries loads the libraries of paths, a comma separated list, as
+// LoadOpLibrary does. An empty list loads nothing.
+func LoadOpLibraries(paths string) ([]*OpLibrary, error) {
+	var libs []*OpLibrary
+	for _, path := range strings.Split(paths, ",") {
+		if path == "" {
+			continue
+		}
+		lib, err := LoadOpLibrary(path)
+		if err != nil {
+			return nil, err
+		}
+		libs = append(libs, lib)
+	}
+	return libs, nil
+}
+
+// RegisteredOps returns the names of every op registered with TensorFlow,
+// including those of the loaded op libraries.
+func RegisteredOps() (map[string]bool, error) {
+	buf := C.TF_GetAllOpList()
+	defer C.TF_DeleteBuffer(buf)
+	ops, err := opNames(C.GoBytes(buf.data, C.int(buf.length)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the registered ops: %v", err)
+	}
+	registered := make(map[string]bool, len(ops))
+	for _, op := range ops {
+		registered[op] = true
+	}
+	return registered, nil
+}
+
+// opNames decodes a serialized OpList into sorted op names.
+func opNames(b []byte) ([]string, error) {
+	list := &framework.OpList{}
+	if err := proto.Unmarshal(b, list); err != nil {
+		return nil, err
+	}
+	names := make([]string, len(list.Op))
+	for i, op := range list.Op {
+		names[i] = op.Name
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// CheckGraphOps fails if def uses ops that are not registered with
+// TensorFlow, naming the library to load when it is known. Importing such a
+// graph fails with a much less helpful error.
+func CheckGraphOps(def *framework.GraphDef) error {
+	registered, err := RegisteredOps()
+	if err != nil {
+		return err
+	}
+
+	// Nodes may call the functions of the graph as ops.
+	functions := map[string]bool{}
+	nodes := append([]*framework.NodeDef(nil), def.Node...)
+	if def.Library != nil {
+		for _, f := range def.Library.Function {
+			if f.Signature != nil {
+				functions[f.Signature.Name] = true
+			}
+			nodes = append(nodes, f.NodeDef...)
+		}
+	}
+
+	missing := map[string]bool{}
+	for _, node := range nodes {
+		if !registered[node.Op] && !functions[node.Op] {
+			missing[node.Op] = true
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	ops := make([]string, 0, len(missing))
+	for op := range missing {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	msgs := make([]string, len(ops))
+	for i, op := range ops {
+		msgs[i] = fmt.Sprintf("op %s not registered", op)
+		if lib, ok := opLibraryHints[op]; ok {
+			msgs[i] += ", load " + lib
+		}
+	}
+	return fmt.Errorf("%s", strings.Join(msgs, "; "))
+}
+
+// checkGraphDef is CheckGraphOps for a serialized GraphDef. Definitions that
+// do not parse are left for the import to report.
+func checkGraphDef(b []byte) error {
+	def := &framework.GraphDef{}
+	if err := proto.Unmarshal(b, def); err != nil {
+		return nil
+	}
+	return CheckGraphOps(def)
+}
+
+// checkSavedModelOps is CheckGraphOps for the meta graph of the SavedModel in
+// dir tagged with tags. Meta graphs that cannot be read are left for the
+// loader to report.
+func checkSavedModelOps(dir string, tags []string) error {
+	mg, err := ReadMetaGraph(dir, tags)
+	if err != nil || mg.GraphDef == nil {
+		return nil
+	}
+	return CheckGraphOps(mg.GraphDef)
+}
@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	tfproto "github.com/tensorflow/tensorflow/tensorflow/go/core/protobuf"
+)
+
+// SESSION POOL
+
+// ErrQueueFull is returned by SessionPool.Run when too many runs are waiting.
+var ErrQueueFull = errors.New("too many requests are queued")
+
+// NewSessionOptions returns session options limiting the threads TensorFlow
+// uses within an operation (intraOp) and across independent operations
+// (interOp). Zero lets TensorFlow pick.
+func NewSessionOptions(intraOp, interOp int) (*tf.SessionOptions, error) {
+	config, err := proto.Marshal(&tfproto.ConfigProto{
+		IntraOpParallelismThreads: int32(intraOp),
+		InterOpParallelismThreads: int32(interOp),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &tf.SessionOptions{Config: config}, nil
+}
+
+// PoolOptions configures a SessionPool.
+type PoolOptions struct {
+	// Sessions is the number of sessions, 1 by default.
+	Sessions int `json:"sessions,omitempty" yaml:"sessions,omitempty"`
+	// MaxInFlight limits the runs executing at once, Sessions by default.
+	MaxInFlight int `json:"max_in_flight,omitempty" yaml:"max_in_flight,omitempty"`
+	// MaxQueue limits the runs waiting for one of the MaxInFlight slots.
+	// Zero means no limit.
+	MaxQueue int `json:"max_queue,omitempty" yaml:"max_queue,omitempty"`
+	// Timeout bounds every run, including the time spent queued.
+	Timeout time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// SessionPool runs a graph on several sessions, limiting the number of
+// concurrent runs. It is safe for concurrent use.
+type SessionPool struct {
+	// Accessed atomically, first for 64-bit alignment.
+	next     uint64
+	queued   int64
+	inFlight int64
+
+	sessions []*tf.Session
+	owned    []*tf.Session
+	slots    chan struct{}
+	options  PoolOptions
+}
+
+// NewSessionPool creates a pool over graph. session, if not nil, is the first
+// session of the pool and is not closed by the pool; the others are created
+// with sessionOptions. Sessions created by the pool start from the graph
+// alone: variables restored into session, as by tf.LoadSavedModel, are not
+// available to them, so only use more than one session with frozen graphs.
+func NewSessionPool(graph *tf.Graph, session *tf.Session, sessionOptions *tf.SessionOptions, options PoolOptions) (*SessionPool, error) {
+	if options.Sessions <= 0 {
+		options.Sessions = 1
+	}
+	if options.MaxInFlight <= 0 {
+		options.MaxInFlight = options.Sessions
+	}
+
+	p := &SessionPool{
+		slots:   make(chan struct{}, options.MaxInFlight),
+		options: options,
+	}
+	if session != nil {
+		p.sessions = append(p.sessions, session)
+	}
+	for len(p.sessions) < options.Sessions {
+		s, err := tf.NewSession(graph, sessionOptions)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.sessions = append(p.sessions, s)
+		p.owned = append(p.owned, s)
+	}
+	return p, nil
+}
+
+// Run waits for a free slot and runs the graph on the next session. It
+// returns early with the error of ctx if ctx is done before the run
+// completes; the run itself cannot be interrupted and keeps its slot until it
+// finishes.
+func (p *SessionPool) Run(ctx context.Context, feeds map[tf.Output]*tf.Tensor, fetches []tf.Output, targets []*tf.Operation) ([]*tf.Tensor, error) {
+	if p.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.options.Timeout)
+		defer cancel()
+	}
+
+	queued := atomic.AddInt64(&p.queued, 1)
+	if p.options.MaxQueue > 0 && queued > int64(p.options.MaxQueue) {
+		atomic.AddInt64(&p.queued, -1)
+		return nil, ErrQueueFull
+	}
+	select {
+	case p.slots <- struct{}{}:
+		atomic.AddInt64(&p.queued, -1)
+	case <-ctx.Done():
+		atomic.AddInt64(&p.queued, -1)
+		return nil, ctx.Err()
+	}
+
+	atomic.AddInt64(&p.inFlight, 1)
+	session := p.sessions[atomic.AddUint64(&p.next, 1)%uint64(len(p.sessions))]
+
+	type result struct {
+		outputs []*tf.Tensor
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		outputs, err := session.Run(feeds, fetches, targets)
+		atomic.AddInt64(&p.inFlight, -1)
+		<-p.slots
+		done <- result{outputs, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.outputs, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// QueueDepth returns the number of runs waiting for a slot.
+func (p *SessionPool) QueueDepth() int {
+	return int(atomic.LoadInt64(&p.queued))
+}
+
+// InFlight returns the number of runs executing.
+func (p *SessionPool) InFlight() int {
+	return int(atomic.LoadInt64(&p.inFlight))
+}
+
+// Size returns the number of sessions of the pool.
+func (p *SessionPool) Size() int {
+	return len(p.sessions)
+}
+
+// Close closes the sessions created by the pool.
+func (p *SessionPool) Close() error {
+	var firstErr error
+	for _, s := range p.owned {
+		if err := s.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	p.owned = nil
+	return firstErr
+}
+
+// PoolStats reports the load of a SessionPool.
+type PoolStats struct {
+	Sessions   int `json:"sessions"`
+	InFlight   int `json:"in_flight"`
+	QueueDepth int `json:"queue_depth"`
+}
+
+// Stats returns the current load of the pool.
+func (p *SessionPool) Stats() PoolStats {
+	return PoolStats{Sessions: p.Size(), InFlight: p.InFlight(), QueueDepth: p.QueueDepth()}
+}
@@ -0,0 +1,385 @@
+package utils
+
+// #include <stdlib.h>
+// #include "tensorflow/c/c_api.h"
+import "C"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+	"unsafe"
+
+	"github.com/golang/protobuf/proto"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/core/framework"
+	tfproto "github.com/tensorflow/tensorflow/tensorflow/go/core/protobuf"
+)
+
+// PROFILING
+
+// RunWithTrace runs session like Session.Run, asking TensorFlow for a full
+// trace of the execution, and returns the step statistics of the run. The Go
+// API does not expose run options, so the run goes through the C API.
+func RunWithTrace(session *tf.Session, feeds map[tf.Output]*tf.Tensor, fetches []tf.Output, targets []*tf.Operation) ([]*tf.Tensor, *framework.StepStats, error) {
+	options, err := proto.Marshal(&tfproto.RunOptions{TraceLevel: tfproto.RunOptions_FULL_TRACE})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		inputs       = make([]C.TF_Output, 0, len(feeds))
+		inputValues  = make([]*C.TF_Tensor, 0, len(feeds))
+		outputs      = make([]C.TF_Output, len(fetches))
+		outputValues = make([]*C.TF_Tensor, len(fetches))
+		targetOps    = make([]*C.TF_Operation, len(targets))
+	)
+	for output, t := range feeds {
+		inputs = append(inputs, outputC(output))
+		inputValues = append(inputValues, TensorPtrC(t))
+	}
+	for i, output := range fetches {
+		outputs[i] = outputC(output)
+	}
+	for i, op := range targets {
+		targetOps[i] = operationPtrC(op)
+	}
+
+	cOptions := C.CBytes(options)
+	defer C.free(cOptions)
+	runOptions := C.TF_NewBufferFromString(cOptions, C.size_t(len(options)))
+	defer C.TF_DeleteBuffer(runOptions)
+	runMetadata := C.TF_NewBuffer()
+	defer C.TF_DeleteBuffer(runMetadata)
+	status := C.TF_NewStatus()
+	defer C.TF_DeleteStatus(status)
+
+	C.TF_SessionRun(sessionPtrC(session), runOptions,
+		ptrOutput(inputs), ptrTensor(inputValues), C.int(len(inputs)),
+		ptrOutput(outputs), ptrTensor(outputValues), C.int(len(outputs)),
+		ptrOperation(targetOps), C.int(len(targetOps)),
+		runMetadata, status)
+	// The C pointers above are not references the GC knows of: keep the Go
+	// wrappers, whose finalizers free them, alive until the run is over.
+	runtime.KeepAlive(feeds)
+	runtime.KeepAlive(fetches)
+	runtime.KeepAlive(targets)
+	runtime.KeepAlive(session)
+	if C.TF_GetCode(status) != C.TF_OK {
+		return nil, nil, fmt.Errorf("%s", C.GoString(C.TF_Message(status)))
+	}
+
+	results := make([]*tf.Tensor, len(outputValues))
+	for i, c := range outputValues {
+		t, err := tensorFromC(c)
+		C.TF_DeleteTensor(c)
+		if err != nil {
+			for _, rest := range outputValues[i+1:] {
+				C.TF_DeleteTensor(rest)
+			}
+			return nil, nil, err
+		}
+		results[i] = t
+	}
+
+	metadata := &tfproto.RunMetadata{}
+	b := C.GoBytes(runMetadata.data, C.int(runMetadata.length))
+	if err := proto.Unmarshal(b, metadata); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode run metadata: %v", err)
+	}
+	return results, metadata.StepStats, nil
+}
+
+func ptrOutput(l []C.TF_Output) *C.TF_Output {
+	if len(l) == 0 {
+		return nil
+	}
+	return &l[0]
+}
+
+func ptrTensor(l []*C.TF_Tensor) **C.TF_Tensor {
+	if len(l) == 0 {
+		return nil
+	}
+	return &l[0]
+}
+
+func ptrOperation(l []*C.TF_Operation) **C.TF_Operation {
+	if len(l) == 0 {
+		return nil
+	}
+	return &l[0]
+}
+
+func outputC(output tf.Output) C.TF_Output {
+	return C.TF_Output{oper: operationPtrC(output.Op), index: C.int(output.Index)}
+}
+
+// operationPtrC and sessionPtrC read the C pointers wrapped by the Go API,
+// like TensorPtrC.
+func operationPtrC(op *tf.Operation) *C.TF_Operation {
+	fld := reflect.Indirect(reflect.ValueOf(op)).FieldByName("c")
+	return *(**C.TF_Operation)(unsafe.Pointer(fld.UnsafeAddr()))
+}
+
+func sessionPtrC(s *tf.Session) *C.TF_Session {
+	fld := reflect.Indirect(reflect.ValueOf(s)).FieldByName("c")
+	return *(**C.TF_Session)(unsafe.Pointer(fld.UnsafeAddr()))
+}
+
+// tensorFromC copies a tensor returned by the C API into a Go tensor.
+func tensorFromC(c *C.TF_Tensor) (*tf.Tensor, error) {
+	dtype := tf.DataType(C.TF_TensorType(c))
+	shape := make([]int64, int(C.TF_NumDims(c)))
+	for i := range shape {
+		shape[i] = int64(C.TF_Dim(c, C.int(i)))
+	}
+	data := TensorData(c)
+	if dtype != tf.String {
+		return tf.ReadTensor(dtype, shape, bytes.NewReader(data))
+	}
+	if tstringLayout() {
+		return nil, fmt.Errorf("string tensors cannot be fetched by traced runs with TensorFlow %s, which stores them as TF_TString", tf.Version())
+	}
+
+	// String tensors hold one 64-bit offset per element followed by the
+	// varint length prefixed strings.
+	n := int(NumElements(shape))
+	if len(data) < 8*n {
+		return nil, fmt.Errorf("invalid string tensor")
+	}
+	strs := make([]string, n)
+	body := data[8*n:]
+	for i := range strs {
+		offset := binary.LittleEndian.Uint64(data[8*i:])
+		if offset >= uint64(len(body)) {
+			return nil, fmt.Errorf("invalid string tensor")
+		}
+		length, k := binary.Uvarint(body[offset:])
+		start := offset + uint64(k)
+		if k <= 0 || start+length > uint64(len(body)) {
+			return nil, fmt.Errorf("invalid string tensor")
+		}
+		strs[i] = string(body[start : start+length])
+	}
+	return ReshapeTensor(strs, shape)
+}
+
+// tstringLayout reports whether the TensorFlow library stores string
+// tensors as TF_TString, as from version 2.4 on, rather than as the offsets
+// and varint length prefixed strings tensorFromC decodes.
+func tstringLayout() bool {
+	var major, minor int
+	if _, err := fmt.Sscanf(tf.Version(), "%d.%d", &major, &minor); err != nil {
+		return false
+	}
+	return major > 2 || major == 2 && minor >= 4
+}
+
+// OpStats is the time spent in one node or one op type.
+type OpStats struct {
+	Name  string        `json:"name"`
+	Type  string        `json:"type,omitempty"`
+	Count int           `json:"count"`
+	Total time.Duration `json:"total"`
+}
+
+// Profile accumulates the step statistics of traced runs of a graph. It is
+// safe for concurrent use.
+type Profile struct {
+	graph *tf.Graph
+
+	mu    sync.Mutex
+	steps []*framework.StepStats
+	nodes map[string]*OpStats
+	types map[string]*OpStats
+}
+
+// NewProfile returns an empty profile of graph, used to find the type of
+// the traced nodes.
+func NewProfile(graph *tf.Graph) *Profile {
+	return &Profile{
+		graph: graph,
+		nodes: map[string]*OpStats{},
+		types: map[string]*OpStats{},
+	}
+}
+
+// Add accumulates the statistics of one run.
+func (p *Profile) Add(stats *framework.StepStats) {
+	if stats == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.steps = append(p.steps, stats)
+	for _, dev := range stats.DevStats {
+		for _, node := range dev.NodeStats {
+			d := time.Duration(node.AllEndRelMicros) * time.Microsecond
+			name, typ := p.node(node.NodeName)
+
+			n, ok := p.nodes[name]
+			if !ok {
+				n = &OpStats{Name: name, Type: typ}
+				p.nodes[name] = n
+			}
+			n.Count++
+			n.Total += d
+
+			t, ok := p.types[typ]
+			if !ok {
+				t = &OpStats{Name: typ}
+				p.types[typ] = t
+			}
+			t.Count++
+			t.Total += d
+		}
+	}
+}
+
+// node returns the graph node and op type of a traced node name. GPU traces
+// suffix node names with ":" and the op type.
+func (p *Profile) node(name string) (string, string) {
+	if op := p.graph.Operation(name); op != nil {
+		return name, op.Type()
+	}
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		if op := p.graph.Operation(name[:i]); op != nil {
+			return name[:i], op.Type()
+		}
+		return name[:i], name[i+1:]
+	}
+	// Runtime nodes such as _SOURCE and _Recv are not part of the graph.
+	return name, name
+}
+
+// Runs returns the number of runs in the profile.
+func (p *Profile) Runs() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.steps)
+}
+
+// Nodes returns the time spent in every node, by decreasing total.
+func (p *Profile) Nodes() []OpStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return sortedStats(p.nodes)
+}
+
+// Types returns the time spent in every op type, by decreasing total.
+func (p *Profile) Types() []OpStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return sortedStats(p.types)
+}
+
+func sortedStats(m map[string]*OpStats) []OpStats {
+	stats := make([]OpStats, 0, len(m))
+	for _, s := range m {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Total != stats[j].Total {
+			return stats[i].Total > stats[j].Total
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+// WriteTable writes the top op types and nodes by total time as text
+// tables. top <= 0 writes every row.
+func (p *Profile) WriteTable(w io.Writer, top int) error {
+	types, nodes := p.Types(), p.Nodes()
+	var total time.Duration
+	for _, t := range types {
+		total += t.Total
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	write := func(title string, stats []OpStats, withType bool) {
+		fmt.Fprintf(tw, "%s\tcount\ttotal\tavg\t%%\n", title)
+		for i, s := range stats {
+			if top > 0 && i == top {
+				break
+			}
+			name := s.Name
+			if withType {
+				name = fmt.Sprintf("%s (%s)", s.Name, s.Type)
+			}
+			pct := 0.0
+			if total > 0 {
+				pct = 100 * float64(s.Total) / float64(total)
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%v\t%v\t%.1f\n", name, s.Count, s.Total, s.Total/time.Duration(s.Count), pct)
+		}
+		fmt.Fprintln(tw)
+	}
+	fmt.Fprintf(tw, "%d runs, %v in ops\n\n", p.Runs(), total)
+	write("op type", types, false)
+	write("node", nodes, true)
+	return tw.Flush()
+}
+
+// traceEvent is an event of the Chrome trace event format, see
+// https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type traceEvent struct {
+	Name string            `json:"name"`
+	Cat  string            `json:"cat,omitempty"`
+	Ph   string            `json:"ph"`
+	Ts   int64             `json:"ts"`
+	Dur  int64             `json:"dur,omitempty"`
+	Pid  int               `json:"pid"`
+	Tid  uint32            `json:"tid"`
+	Args map[string]string `json:"args,omitempty"`
+}
+
+// WriteChromeTrace writes every traced run in the Chrome trace event format,
+// which chrome://tracing and Perfetto open. Each device is a process and
+// each of its threads a track.
+func (p *Profile) WriteChromeTrace(w io.Writer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	devices := map[string]int{}
+	var events []traceEvent
+	for _, step := range p.steps {
+		for _, dev := range step.DevStats {
+			pid, ok := devices[dev.Device]
+			if !ok {
+				pid = len(devices)
+				devices[dev.Device] = pid
+				events = append(events, traceEvent{
+					Name: "process_name",
+					Ph:   "M",
+					Pid:  pid,
+					Args: map[string]string{"name": dev.Device},
+				})
+			}
+			for _, node := range dev.NodeStats {
+				name, typ := p.node(node.NodeName)
+				events = append(events, traceEvent{
+					Name: typ,
+					Cat:  "Op",
+					Ph:   "X",
+					Ts:   node.AllStartMicros,
+					Dur:  node.AllEndRelMicros,
+					Pid:  pid,
+					Tid:  node.ThreadId,
+					Args: map[string]string{"name": name, "op": typ, "label": node.TimelineLabel},
+				})
+			}
+		}
+	}
+	return json.NewEncoder(w).Encode(map[string]interface{}{"traceEvents": events})
+}
@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/core/framework"
+	tfproto "github.com/tensorflow/tensorflow/tensorflow/go/core/protobuf"
+)
+
+// SAVEDMODEL UTILITY FUNCTIONS
+
+// Signature is a signature def of a SavedModel. Inputs and outputs are keyed
+// by their logical name in the signature; Name is the tensor in the graph.
+type Signature struct {
+	Key        string       `json:"key"`
+	MethodName string       `json:"method_name,omitempty"`
+	Inputs     []TensorSpec `json:"inputs"`
+	Outputs    []TensorSpec `json:"outputs"`
+}
+
+// ReadMetaGraph reads the meta graph of the SavedModel in dir whose tags are
+// exactly tags.
+func ReadMetaGraph(dir string, tags []string) (*tfproto.MetaGraphDef, error) {
+	path := filepath.Join(dir, "saved_model.pb")
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	saved := &tfproto.SavedModel{}
+	if err := proto.Unmarshal(b, saved); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	var available []string
+	for _, mg := range saved.MetaGraphs {
+		var have []string
+		if mg.MetaInfoDef != nil {
+			have = mg.MetaInfoDef.Tags
+		}
+		if sameTags(have, tags) {
+			return mg, nil
+		}
+		available = append(available, "{"+strings.Join(have, ",")+"}")
+	}
+	return nil, fmt.Errorf("%s has no meta graph tagged {%s}, available: %s",
+		dir, strings.Join(tags, ","), strings.Join(available, " "))
+}
+
+func sameTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]bool, len(a))
+	for _, tag := range a {
+		set[tag] = true
+	}
+	for _, tag := range b {
+		if !set[tag] {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadSignatures returns the signature defs of the meta graph of the
+// SavedModel in dir tagged with tags, sorted by key.
+func ReadSignatures(dir string, tags []string) ([]Signature, error) {
+	mg, err := ReadMetaGraph(dir, tags)
+	if err != nil {
+		return nil, err
+	}
+	return Signatures(mg), nil
+}
+
+// Signatures returns the signature defs of mg sorted by key, with their
+// inputs and outputs sorted by logical name.
+func Signatures(mg *tfproto.MetaGraphDef) []Signature {
+	var sigs []Signature
+	for key, def := range mg.SignatureDef {
+		sigs = append(sigs, Signature{
+			Key:        key,
+			MethodName: def.MethodName,
+			Inputs:     signatureSpecs(def.Inputs),
+			Outputs:    signatureSpecs(def.Outputs),
+		})
+	}
+	sort.Slice(sigs, func(i, j int) bool { return sigs[i].Key < sigs[j].Key })
+	return sigs
+}
+
+func signatureSpecs(infos map[string]*tfproto.TensorInfo) []TensorSpec {
+	specs := make([]TensorSpec, 0, len(infos))
+	for key, info := range infos {
+		spec := TensorSpec{
+			Key:   key,
+			Name:  info.GetName(),
+			DType: DataTypeName(tf.DataType(info.Dtype)),
+		}
+		spec.Shape = protoShape(info.TensorShape)
+		specs = append(specs, spec)
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Key < specs[j].Key })
+	return specs
+}
+
+// protoShape converts a TensorShapeProto, nil for an unknown rank.
+func protoShape(shape *framework.TensorShapeProto) []int64 {
+	if shape == nil || shape.UnknownRank {
+		return nil
+	}
+	dims := make([]int64, len(shape.Dim))
+	for i, dim := range shape.Dim {
+		dims[i] = dim.Size
+	}
+	return dims
+}
+
+// ReadSignature returns the signature def called key of the SavedModel in
+// dir.
+func ReadSignature(dir string, tags []string, key string) (Signature, error) {
+	sigs, err := ReadSignatures(dir, tags)
+	if err != nil {
+		return Signature{}, err
+	}
+	keys := make([]string, len(sigs))
+	for i, sig := range sigs {
+		if sig.Key == key {
+			return sig, nil
+		}
+		keys[i] = sig.Key
+	}
+	if len(keys) == 0 {
+		return Signature{}, fmt.Errorf("%s has no signature defs", dir)
+	}
+	return Signature{}, fmt.Errorf("%s has no signature %q, available: %s", dir, key, strings.Join(keys, ", "))
+}
+
+// InputNames maps the logical input keys of the signature to tensor names,
+// as expected by NewModel.
+func (s Signature) InputNames() map[string]string {
+	return specNames(s.Inputs)
+}
+
+// OutputNames maps the logical output keys of the signature to tensor
+// names, as expected by NewModel.
+func (s Signature) OutputNames() map[string]string {
+	return specNames(s.Outputs)
+}
+
+func specNames(specs []TensorSpec) map[string]string {
+	names := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		names[spec.Key] = spec.Name
+	}
+	return names
+}
+
+// LoadSignature loads the SavedModel in dir tagged with tags and returns a
+// model whose inputs and outputs are those of the signature called key, so
+// that Run takes and returns tensors by their logical keys.
+func LoadSignature(dir string, tags []string, key string, options *tf.SessionOptions) (*Model, error) {
+	sig, err := ReadSignature(dir, tags, key)
+	if err != nil {
+		return nil, err
+	}
+	return LoadSavedModel(dir, tags, sig.InputNames(), sig.OutputNames(), options)
+}
@@ -0,0 +1,469 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	utils "github.com/rai-project/tensorflow-go-examples"
+	"github.com/rai-project/tensorflow-go-examples/task"
+)
+
+// maxImageSize bounds the size of uploaded images.
+const maxImageSize = 32 << 20
+
+// maxCTRRequestSize bounds the size of ranking requests.
+const maxCTRRequestSize = 1 << 20
+
+// maskThreshold is the probability above which a mask pixel belongs to the
+// object.
+const maskThreshold = 0.5
+
+type prediction struct {
+	Index       int     `json:"index"`
+	Label       string  `json:"label,omitempty"`
+	Probability float32 `json:"probability"`
+}
+
+type classifyResponse struct {
+	Predictions []prediction `json:"predictions"`
+}
+
+// RLE is the uncompressed COCO run-length encoding of a binary mask the size
+// of the image: counts alternate between runs of 0 and 1 in column-major
+// order, starting with 0.
+type RLE struct {
+	Size   [2]int `json:"size"`
+	Counts []int  `json:"counts"`
+}
+
+type detection struct {
+	task.Detection
+	Mask *RLE `json:"mask,omitempty"`
+}
+
+type detectResponse struct {
+	Detections []detection `json:"detections"`
+}
+
+type segmentResponse struct {
+	Width  int      `json:"width"`
+	Height int      `json:"height"`
+	Labels []string `json:"labels,omitempty"`
+	Mask   []byte   `json:"mask"`
+}
+
+type enhanceResponse struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Image  []byte `json:"image"`
+}
+
+type ctrResponse struct {
+	UID        string            `json:"uid"`
+	Candidates []task.RankedItem `json:"candidates"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func (s *Server) handleClassify(w http.ResponseWriter, r *http.Request) {
+	if s.classifier == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no classification model is loaded"))
+		return
+	}
+	img, ok := readImage(w, r)
+	if !ok {
+		return
+	}
+	topk, err := intParam(r, "topk", 5)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	preds, err := s.classifier.TopKContext(r.Context(), img, topk)
+	if err != nil {
+		writeRunError(w, err)
+		return
+	}
+
+	resp := classifyResponse{Predictions: []prediction{}}
+	for ii := 0; ii < topk && ii < preds.Len(); ii++ {
+		resp.Predictions = append(resp.Predictions, prediction{
+			Index:       preds.Indexes[ii],
+			Label:       s.classifier.Label(preds.Indexes[ii]),
+			Probability: preds.Probabilities[ii],
+		})
+	}
+
+	if wantsJPEG(r) {
+		out := toRGBA(img)
+		if len(resp.Predictions) != 0 {
+			p := resp.Predictions[0]
+			utils.AddLabel(out, 0, 13, 0, fmt.Sprintf("%s (%2.0f%%)", p.Label, p.Probability*100.0))
+		}
+		writeJPEG(w, out)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleDetect(w http.ResponseWriter, r *http.Request) {
+	if s.detector == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no detection model is loaded"))
+		return
+	}
+	s.serveDetections(w, r, s.detector)
+}
+
+func (s *Server) handleSegment(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = "semantic"
+		if s.semantic == nil {
+			mode = "instances"
+		}
+	}
+
+	switch {
+	case mode == "instances" && s.instances != nil:
+		s.serveDetections(w, r, s.instances)
+	case mode == "semantic" && s.semantic != nil:
+		s.serveSemantic(w, r)
+	case mode != "instances" && mode != "semantic":
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown segmentation mode %q", mode))
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no %s segmentation model is loaded", mode))
+	}
+}
+
+func (s *Server) serveDetections(w http.ResponseWriter, r *http.Request, detector *task.Detector) {
+	img, ok := readImage(w, r)
+	if !ok {
+		return
+	}
+
+	detections, err := detector.DetectContext(r.Context(), img)
+	if err != nil {
+		writeRunError(w, err)
+		return
+	}
+
+	if wantsJPEG(r) {
+		writeJPEG(w, task.DrawDetections(img, detections))
+		return
+	}
+
+	resp := detectResponse{Detections: []detection{}}
+	b := img.Bounds()
+	for _, det := range detections {
+		d := detection{Detection: det}
+		if det.Mask != nil {
+			d.Mask = EncodeRLE(det.Mask, det.Box, b.Dx(), b.Dy(), maskThreshold)
+		}
+		resp.Detections = append(resp.Detections, d)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) serveSemantic(w http.ResponseWriter, r *http.Request) {
+	img, ok := readImage(w, r)
+	if !ok {
+		return
+	}
+
+	seg, err := s.semantic.SegmentContext(r.Context(), img)
+	if err != nil {
+		writeRunError(w, err)
+		return
+	}
+
+	if wantsJPEG(r) {
+		writeJPEG(w, seg.Overlay())
+		return
+	}
+
+	// The mask is a grayscale PNG holding the class index of every pixel.
+	mask := image.NewGray(image.Rect(0, 0, seg.Width, seg.Height))
+	for y := 0; y < seg.Height; y++ {
+		for x := 0; x < seg.Width; x++ {
+			mask.Pix[y*mask.Stride+x] = uint8(seg.Classes[y][x])
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, mask); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, segmentResponse{
+		Width:  seg.Width,
+		Height: seg.Height,
+		Labels: task.PascalLabelNames,
+		Mask:   buf.Bytes(),
+	})
+}
+
+func (s *Server) handleEnhance(w http.ResponseWriter, r *http.Request) {
+	if s.enhancer == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no enhancement model is loaded"))
+		return
+	}
+	img, ok := readImage(w, r)
+	if !ok {
+		return
+	}
+
+	enhanced, err := s.enhancer.EnhanceContext(r.Context(), img)
+	if err != nil {
+		writeRunError(w, err)
+		return
+	}
+
+	if wantsJPEG(r) {
+		writeJPEG(w, enhanced)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, enhanced); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, enhanceResponse{
+		Width:  enhanced.Bounds().Dx(),
+		Height: enhanced.Bounds().Dy(),
+		Image:  buf.Bytes(),
+	})
+}
+
+// handleCTR ranks the candidate items of a JSON task.CTRRequest by click
+// probability.
+func (s *Server) handleCTR(w http.ResponseWriter, r *http.Request) {
+	if s.ctr == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no ctr model is loaded"))
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	var req task.CTRRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxCTRRequestSize)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %v", err))
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ranked, err := s.ctr.RankContext(r.Context(), &req)
+	if err != nil {
+		writeRunError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ctrResponse{UID: req.UID, Candidates: ranked})
+}
+
+type modelStatus struct {
+	Batching bool             `json:"batching"`
+	Pool     *utils.PoolStats `json:"pool,omitempty"`
+}
+
+// handleStatus reports the load of every loaded model, keyed by task or
+// served model name.
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	models := map[string]*utils.Model{}
+	for _, name := range []string{task.Classify, task.Detect, task.SegmentInstances, task.SegmentSemantic, task.Enhance, task.CTR} {
+		if m := s.taskModel(name); m != nil {
+			models[name] = m
+		}
+	}
+	for name, m := range s.served {
+		models[name] = m.model
+	}
+
+	status := map[string]modelStatus{}
+	for name, m := range models {
+		st := modelStatus{Batching: m.Batching()}
+		if pool := m.Pool(); pool != nil {
+			stats := pool.Stats()
+			st.Pool = &stats
+		}
+		status[name] = st
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"models": status})
+}
+
+// EncodeRLE encodes the mask of a detection as a COCO run-length encoding
+// of an image of the given size. mask is relative to box, like the masks of
+// Mask R-CNN: it is scaled to the box and pasted into the image the way
+// utils.Segment draws it, then thresholded.
+func EncodeRLE(mask [][]float32, box [4]float32, width, height int, threshold float32) *RLE {
+	rle := &RLE{Size: [2]int{height, width}}
+
+	maskHeight, maskWidth := len(mask), 0
+	if maskHeight != 0 {
+		maskWidth = len(mask[0])
+	}
+	y1, x1 := int(float32(height)*box[0]), int(float32(width)*box[1])
+	y2, x2 := int(float32(height)*box[2]), int(float32(width)*box[3])
+	inside := func(x, y int) bool {
+		if maskWidth == 0 || x < x1 || x >= x2 || y < y1 || y >= y2 {
+			return false
+		}
+		// Nearest neighbour of the center of the pixel in the mask.
+		mx := (2*(x-x1) + 1) * maskWidth / (2 * (x2 - x1))
+		my := (2*(y-y1) + 1) * maskHeight / (2 * (y2 - y1))
+		return mask[my][mx] > threshold
+	}
+
+	var prev bool
+	count := 0
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			v := inside(x, y)
+			if v != prev {
+				rle.Counts = append(rle.Counts, count)
+				count = 0
+				prev = v
+			}
+			count++
+		}
+	}
+	rle.Counts = append(rle.Counts, count)
+	return rle
+}
+
+// readImage decodes the image uploaded as the "image" field of a multipart
+// form or as the raw request body. It writes an error response and returns
+// false on failure.
+func readImage(w http.ResponseWriter, r *http.Request) (image.Image, bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return nil, false
+	}
+
+	body, err := readBody(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	img, _, err := image.Decode(bytes.NewReader(body))
+	if err != nil {
+		writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("failed to decode image: %v", err))
+		return nil, false
+	}
+	return img, true
+}
+
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageSize)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return ioutil.ReadAll(r.Body)
+	}
+
+	if err := r.ParseMultipartForm(maxImageSize); err != nil {
+		return nil, err
+	}
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		// Fall back to the first uploaded file, whatever its field name.
+		for _, headers := range r.MultipartForm.File {
+			if len(headers) != 0 {
+				file, err = headers[0].Open()
+				break
+			}
+		}
+		if file == nil {
+			return nil, fmt.Errorf("no image in multipart form")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer file.Close()
+	return ioutil.ReadAll(file)
+}
+
+func intParam(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, v)
+	}
+	return n, nil
+}
+
+// wantsJPEG reports whether the client asked for the rendered image.
+func wantsJPEG(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(accept))
+		if mediaType == "image/jpeg" {
+			return true
+		}
+	}
+	return false
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(b)
+	draw.Draw(out, b, img, b.Min, draw.Src)
+	return out
+}
+
+func writeJPEG(w http.ResponseWriter, img image.Image) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80}); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, errorResponse{Error: err.Error()})
+}
+
+// writeRunError reports a failed model run, distinguishing overload and
+// timeouts from model errors.
+func writeRunError(w http.ResponseWriter, err error) {
+	switch err {
+	case utils.ErrQueueFull:
+		writeError(w, http.StatusServiceUnavailable, err)
+	case context.DeadlineExceeded:
+		writeError(w, http.StatusGatewayTimeout, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
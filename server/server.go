@@ -0,0 +1,298 @@
+// Package server exposes the example tasks as an HTTP inference service.
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	utils "github.com/rai-project/tensorflow-go-examples"
+	"github.com/rai-project/tensorflow-go-examples/dien/data"
+	"github.com/rai-project/tensorflow-go-examples/task"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ModelConfig selects the model serving one task. Manifest defaults to the
+// model of the example of the task. Batching, if set, batches concurrent
+// requests; the model must accept batches of more than one input. Pool, if
+// set, runs the model on a pool of sessions, see utils.SessionPool.
+// IntraOpThreads and InterOpThreads tune the threads of every session.
+// The ctr task also needs Data, the directory of the DIEN vocabularies and
+// item-info; MaxLen truncates histories and ClickColumn selects the column of
+// the softmax output candidates are ranked by, 1 by default.
+type ModelConfig struct {
+	Manifest       string              `json:"manifest,omitempty" yaml:"manifest,omitempty"`
+	Dir            string              `json:"dir" yaml:"dir"`
+	Threshold      float32             `json:"threshold,omitempty" yaml:"threshold,omitempty"`
+	Batching       *utils.BatchOptions `json:"batching,omitempty" yaml:"batching,omitempty"`
+	Pool           *utils.PoolOptions  `json:"pool,omitempty" yaml:"pool,omitempty"`
+	IntraOpThreads int                 `json:"intra_op_threads,omitempty" yaml:"intra_op_threads,omitempty"`
+	InterOpThreads int                 `json:"inter_op_threads,omitempty" yaml:"inter_op_threads,omitempty"`
+	Data           string              `json:"data,omitempty" yaml:"data,omitempty"`
+	MaxLen         int                 `json:"maxlen,omitempty" yaml:"maxlen,omitempty"`
+	ClickColumn    *int                `json:"click_column,omitempty" yaml:"click_column,omitempty"`
+}
+
+// sessionOptions returns the session options of the model, nil for the
+// defaults of TensorFlow.
+func (mc ModelConfig) sessionOptions() (*tf.SessionOptions, error) {
+	if mc.IntraOpThreads == 0 && mc.InterOpThreads == 0 {
+		return nil, nil
+	}
+	return utils.NewSessionOptions(mc.IntraOpThreads, mc.InterOpThreads)
+}
+
+// setup enables the session pool and batching of model.
+func (mc ModelConfig) setup(model *utils.Model, options *tf.SessionOptions) error {
+	if mc.Pool != nil {
+		if err := model.UsePool(options, *mc.Pool); err != nil {
+			return err
+		}
+	}
+	if mc.Batching != nil {
+		model.EnableBatching(*mc.Batching)
+	}
+	return nil
+}
+
+// Config lists the models loaded by the server. Models are keyed by task name
+// (classify, detect, segment-instances, segment-semantic, enhance, ctr). Serving
+// lists models exposed tensor by tensor through the TensorFlow Serving REST
+// API and the v2 inference protocol, keyed by model name; they need a
+// manifest.
+type Config struct {
+	Addr    string                 `json:"addr,omitempty" yaml:"addr,omitempty"`
+	Models  map[string]ModelConfig `json:"models" yaml:"models"`
+	Serving map[string]ModelConfig `json:"serving,omitempty" yaml:"serving,omitempty"`
+}
+
+// LoadConfig reads a server configuration from a JSON file (.json) or a YAML
+// file (any other extension).
+func LoadConfig(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		err = json.Unmarshal(b, cfg)
+	} else {
+		err = yaml.Unmarshal(b, cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// Server serves the configured models over HTTP.
+type Server struct {
+	classifier *task.Classifier
+	detector   *task.Detector
+	instances  *task.Detector
+	semantic   *task.SemanticSegmenter
+	enhancer   *task.Enhancer
+	ctr        *task.CTRScorer
+	served     map[string]*servedModel
+	mux        *http.ServeMux
+}
+
+// New loads every model of cfg once and returns a server ready to handle
+// requests.
+func New(cfg *Config) (*Server, error) {
+	s := &Server{mux: http.NewServeMux(), served: map[string]*servedModel{}}
+	for name, mc := range cfg.Models {
+		if err := s.load(name, mc); err != nil {
+			s.Close()
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	for name, mc := range cfg.Serving {
+		if err := s.serve(name, mc); err != nil {
+			s.Close()
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+
+	s.mux.HandleFunc("/v1/classify", s.handleClassify)
+	s.mux.HandleFunc("/v1/detect", s.handleDetect)
+	s.mux.HandleFunc("/v1/segment", s.handleSegment)
+	s.mux.HandleFunc("/v1/enhance", s.handleEnhance)
+	s.mux.HandleFunc("/v1/ctr", s.handleCTR)
+	s.mux.HandleFunc("/v1/models/", s.handleTFServing)
+	s.mux.HandleFunc("/v1/status", s.handleStatus)
+	s.mux.HandleFunc("/v2", s.handleV2)
+	s.mux.HandleFunc("/v2/", s.handleV2)
+	return s, nil
+}
+
+func (s *Server) load(name string, mc ModelConfig) error {
+	if mc.Manifest == "" {
+		if path, ok := task.ExampleManifests[name]; ok {
+			return fmt.Errorf("a manifest is required, e.g. %s", path)
+		}
+		return fmt.Errorf("a manifest is required")
+	}
+	manifest, err := utils.LoadManifest(mc.Manifest)
+	if err != nil {
+		return err
+	}
+	options, err := mc.sessionOptions()
+	if err != nil {
+		return err
+	}
+
+	switch name {
+	case task.Classify:
+		s.classifier, err = task.NewClassifier(manifest, mc.Dir, options)
+	case task.Detect:
+		threshold := mc.Threshold
+		if threshold == 0 {
+			threshold = 0.4
+		}
+		s.detector, err = task.NewDetector(manifest, mc.Dir, threshold, options)
+	case task.SegmentInstances:
+		threshold := mc.Threshold
+		if threshold == 0 {
+			threshold = 0.9
+		}
+		s.instances, err = task.NewDetector(manifest, mc.Dir, threshold, options)
+	case task.SegmentSemantic:
+		s.semantic, err = task.NewSemanticSegmenter(manifest, mc.Dir, options)
+	case task.Enhance:
+		s.enhancer, err = task.NewEnhancer(manifest, mc.Dir, options)
+	case task.CTR:
+		s.ctr, err = loadCTR(manifest, mc, options)
+	default:
+		return fmt.Errorf("task is not served over HTTP")
+	}
+	if err != nil {
+		return err
+	}
+	return mc.setup(s.taskModel(name), options)
+}
+
+// taskModel returns the model loaded for task name, or nil.
+func (s *Server) taskModel(name string) *utils.Model {
+	switch {
+	case name == task.Classify && s.classifier != nil:
+		return s.classifier.Model
+	case name == task.Detect && s.detector != nil:
+		return s.detector.Model
+	case name == task.SegmentInstances && s.instances != nil:
+		return s.instances.Model
+	case name == task.SegmentSemantic && s.semantic != nil:
+		return s.semantic.Model
+	case name == task.Enhance && s.enhancer != nil:
+		return s.enhancer.Model
+	case name == task.CTR && s.ctr != nil:
+		return s.ctr.Model
+	}
+	return nil
+}
+
+// loadCTR loads the DIEN model and the vocabularies its requests are mapped
+// through.
+func loadCTR(manifest *utils.Manifest, mc ModelConfig, options *tf.SessionOptions) (*task.CTRScorer, error) {
+	if mc.Data == "" {
+		return nil, fmt.Errorf("data, the directory of the vocabularies, is required")
+	}
+	if mc.ClickColumn != nil && *mc.ClickColumn < 0 {
+		return nil, fmt.Errorf("invalid click_column %d", *mc.ClickColumn)
+	}
+	ds, err := data.Load(data.DefaultPaths(mc.Data))
+	if err != nil {
+		return nil, err
+	}
+	scorer, err := task.NewCTRScorer(manifest, mc.Dir, options)
+	if err != nil {
+		return nil, err
+	}
+	scorer.Dataset, scorer.MaxLen = ds, mc.MaxLen
+	if mc.ClickColumn != nil {
+		scorer.ClickColumn = *mc.ClickColumn
+	}
+	return scorer, nil
+}
+
+func (s *Server) serve(name string, mc ModelConfig) error {
+	if mc.Manifest == "" {
+		return fmt.Errorf("a manifest is required")
+	}
+	manifest, err := utils.LoadManifest(mc.Manifest)
+	if err != nil {
+		return err
+	}
+	options, err := mc.sessionOptions()
+	if err != nil {
+		return err
+	}
+	model, err := manifest.Load(mc.Dir, options)
+	if err != nil {
+		return err
+	}
+	if err := mc.setup(model, options); err != nil {
+		model.Close()
+		return err
+	}
+	m := &servedModel{name: name, model: model, manifest: manifest}
+	m.v2Tensors()
+	s.served[name] = m
+	return nil
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Handle registers an additional handler for pattern.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Close releases every loaded model.
+func (s *Server) Close() error {
+	closers := []interface{ Close() error }{}
+	if s.classifier != nil {
+		closers = append(closers, s.classifier)
+	}
+	if s.detector != nil {
+		closers = append(closers, s.detector)
+	}
+	if s.instances != nil {
+		closers = append(closers, s.instances)
+	}
+	if s.semantic != nil {
+		closers = append(closers, s.semantic)
+	}
+	if s.enhancer != nil {
+		closers = append(closers, s.enhancer)
+	}
+	if s.ctr != nil {
+		closers = append(closers, s.ctr)
+	}
+
+	for _, m := range s.served {
+		closers = append(closers, m.model)
+	}
+
+	var firstErr error
+	for _, c := range closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// ListenAndServe serves s on addr.
+func ListenAndServe(addr string, s *Server) error {
+	log.Printf("serving on %s", addr)
+	return http.ListenAndServe(addr, s)
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"unicode/utf8"
+
+	utils "github.com/rai-project/tensorflow-go-examples"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// DecodeJSONTensor converts v, a JSON value made of nested arrays of numbers,
+// booleans, strings or {"b64": "..."} objects decoded with UseNumber, to a
+// tensor of type dtype.
+func DecodeJSONTensor(v interface{}, dtype tf.DataType) (*tf.Tensor, error) {
+	shape, err := jsonShape(v)
+	if err != nil {
+		return nil, err
+	}
+	var leaves []interface{}
+	if err := jsonLeaves(v, shape, &leaves); err != nil {
+		return nil, err
+	}
+	flat, err := convertLeaves(leaves, dtype)
+	if err != nil {
+		return nil, err
+	}
+	return utils.ReshapeTensor(flat, shape)
+}
+
+// jsonShape returns the shape of v, following the first element of every
+// array. jsonLeaves checks that the other elements agree.
+func jsonShape(v interface{}) ([]int64, error) {
+	var shape []int64
+	for {
+		list, ok := v.([]interface{})
+		if !ok {
+			return shape, nil
+		}
+		shape = append(shape, int64(len(list)))
+		if len(list) == 0 {
+			return shape, nil
+		}
+		v = list[0]
+	}
+}
+
+func jsonLeaves(v interface{}, shape []int64, leaves *[]interface{}) error {
+	list, isList := v.([]interface{})
+	if len(shape) == 0 {
+		if isList {
+			return fmt.Errorf("ragged tensor: unexpected nested list")
+		}
+		*leaves = append(*leaves, v)
+		return nil
+	}
+	if !isList || int64(len(list)) != shape[0] {
+		return fmt.Errorf("ragged tensor: expected a list of %d elements", shape[0])
+	}
+	for _, e := range list {
+		if err := jsonLeaves(e, shape[1:], leaves); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// convertLeaves converts JSON scalars to a slice of the Go type of dtype.
+func convertLeaves(leaves []interface{}, dtype tf.DataType) (interface{}, error) {
+	switch dtype {
+	case tf.String:
+		out := make([]string, len(leaves))
+		for i, leaf := range leaves {
+			s, err := jsonString(leaf)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = s
+		}
+		return out, nil
+	case tf.Bool:
+		out := make([]bool, len(leaves))
+		for i, leaf := range leaves {
+			b, ok := leaf.(bool)
+			if !ok {
+				return nil, fmt.Errorf("expected a boolean, got %v", leaf)
+			}
+			out[i] = b
+		}
+		return out, nil
+	}
+
+	// Numbers are parsed as float64 first and then converted to the element
+	// type of dtype.
+	floats := make([]float64, len(leaves))
+	for i, leaf := range leaves {
+		n, ok := leaf.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("expected a number, got %v", leaf)
+		}
+		f, err := strconv.ParseFloat(string(n), 64)
+		if err != nil {
+			return nil, err
+		}
+		floats[i] = f
+	}
+
+	var elem reflect.Type
+	switch dtype {
+	case tf.Float:
+		elem = reflect.TypeOf(float32(0))
+	case tf.Double:
+		elem = reflect.TypeOf(float64(0))
+	case tf.Int8:
+		elem = reflect.TypeOf(int8(0))
+	case tf.Int16:
+		elem = reflect.TypeOf(int16(0))
+	case tf.Int32:
+		elem = reflect.TypeOf(int32(0))
+	case tf.Int64:
+		elem = reflect.TypeOf(int64(0))
+	case tf.Uint8:
+		elem = reflect.TypeOf(uint8(0))
+	case tf.Uint16:
+		elem = reflect.TypeOf(uint16(0))
+	default:
+		return nil, fmt.Errorf("unsupported dtype %s", utils.DataTypeName(dtype))
+	}
+	out := reflect.MakeSlice(reflect.SliceOf(elem), len(floats), len(floats))
+	for i, f := range floats {
+		out.Index(i).Set(reflect.ValueOf(f).Convert(elem))
+	}
+	return out.Interface(), nil
+}
+
+// jsonString decodes a string or a {"b64": "..."} object.
+func jsonString(v interface{}) (string, error) {
+	switch s := v.(type) {
+	case string:
+		return s, nil
+	case map[string]interface{}:
+		if b64, ok := s["b64"].(string); ok && len(s) == 1 {
+			b, err := base64.StdEncoding.DecodeString(b64)
+			if err != nil {
+				return "", fmt.Errorf("invalid b64 value: %v", err)
+			}
+			return string(b), nil
+		}
+	}
+	return "", fmt.Errorf("expected a string, got %v", v)
+}
+
+// isB64 reports whether v is a {"b64": "..."} value rather than a map of
+// named inputs.
+func isB64(v interface{}) bool {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return false
+	}
+	_, ok = m["b64"]
+	return ok
+}
+
+// EncodeJSONTensor converts t into nested []interface{} ready to be encoded
+// as JSON. Strings that are not valid UTF-8 are encoded as {"b64": "..."}.
+func EncodeJSONTensor(t *tf.Tensor) interface{} {
+	leaves := jsonValues(t)
+	shape := t.Shape()
+	if len(shape) == 0 {
+		return leaves[0]
+	}
+	return nestJSON(leaves, shape)
+}
+
+// jsonValues returns the values of t in row-major order, encoded like
+// EncodeJSONTensor does.
+func jsonValues(t *tf.Tensor) []interface{} {
+	flat := reflect.ValueOf(utils.FlattenTensor(t))
+	leaves := make([]interface{}, flat.Len())
+	for i := range leaves {
+		switch v := flat.Index(i).Interface().(type) {
+		case string:
+			if utf8.ValidString(v) {
+				leaves[i] = v
+			} else {
+				leaves[i] = map[string]string{"b64": base64.StdEncoding.EncodeToString([]byte(v))}
+			}
+		case uint8:
+			// Avoid []byte being encoded as a base64 string.
+			leaves[i] = int(v)
+		default:
+			leaves[i] = v
+		}
+	}
+	return leaves
+}
+
+func nestJSON(leaves []interface{}, shape []int64) []interface{} {
+	if len(shape) == 1 {
+		return leaves
+	}
+	stride := int(utils.NumElements(shape[1:]))
+	out := make([]interface{}, shape[0])
+	for i := range out {
+		out[i] = nestJSON(leaves[i*stride:(i+1)*stride], shape[1:])
+	}
+	return out
+}
@@ -0,0 +1,337 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	utils "github.com/rai-project/tensorflow-go-examples"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// The TensorFlow Serving REST API, see
+// https://www.tensorflow.org/tfx/serving/api_rest. Models are addressed by the
+// name they are configured with and the tensors by the keys of their manifest.
+// Versions are accepted but ignored, every model has version 1.
+
+const defaultSignature = "serving_default"
+
+// servedModel is a model exposed by name through the tensor level APIs.
+type servedModel struct {
+	name     string
+	model    *utils.Model
+	manifest *utils.Manifest
+
+	// inputs and outputs are the tensors of the v2 protocol.
+	inputs  []namedTensor
+	outputs []namedTensor
+}
+
+type predictRequest struct {
+	SignatureName string      `json:"signature_name,omitempty"`
+	Instances     interface{} `json:"instances,omitempty"`
+	Inputs        interface{} `json:"inputs,omitempty"`
+}
+
+type tensorShapeDim struct {
+	Size string `json:"size"`
+}
+
+type tensorShape struct {
+	Dim         []tensorShapeDim `json:"dim,omitempty"`
+	UnknownRank bool             `json:"unknown_rank"`
+}
+
+type tensorInfo struct {
+	DType       string      `json:"dtype"`
+	TensorShape tensorShape `json:"tensor_shape"`
+	Name        string      `json:"name"`
+}
+
+type signatureDef struct {
+	Inputs     map[string]tensorInfo `json:"inputs"`
+	Outputs    map[string]tensorInfo `json:"outputs"`
+	MethodName string                `json:"method_name"`
+}
+
+func (s *Server) handleTFServing(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v1/models/")
+	verb := ""
+	if i := strings.LastIndex(path, ":"); i >= 0 {
+		path, verb = path[:i], path[i+1:]
+	}
+	parts := strings.Split(path, "/")
+	name, parts := parts[0], parts[1:]
+	if len(parts) >= 2 && parts[0] == "versions" {
+		parts = parts[2:]
+	}
+
+	m, ok := s.served[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("servable not found for request: %s", name))
+		return
+	}
+
+	switch {
+	case verb == "" && len(parts) == 0:
+		s.tfServingStatus(w, r, m)
+	case verb == "" && len(parts) == 1 && parts[0] == "metadata":
+		s.tfServingMetadata(w, r, m)
+	case verb == "predict" && len(parts) == 0:
+		s.tfServingPredict(w, r, m)
+	case verb == "classify" || verb == "regress":
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%s is not supported, use predict", verb))
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("malformed request: %s %s", r.Method, r.URL.Path))
+	}
+}
+
+func (s *Server) tfServingStatus(w http.ResponseWriter, r *http.Request, m *servedModel) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"model_version_status": []interface{}{
+			map[string]interface{}{
+				"version": "1",
+				"state":   "AVAILABLE",
+				"status":  map[string]string{"error_code": "OK", "error_message": ""},
+			},
+		},
+	})
+}
+
+func (s *Server) tfServingMetadata(w http.ResponseWriter, r *http.Request, m *servedModel) {
+	sig := signatureDef{
+		Inputs:     map[string]tensorInfo{},
+		Outputs:    map[string]tensorInfo{},
+		MethodName: "tensorflow/serving/predict",
+	}
+	for _, spec := range m.manifest.Inputs {
+		output, _ := m.model.Input(spec.Key)
+		sig.Inputs[spec.Key] = newTensorInfo(spec.Name, output)
+	}
+	for _, spec := range m.manifest.Outputs {
+		output, _ := m.model.Output(spec.Key)
+		sig.Outputs[spec.Key] = newTensorInfo(spec.Name, output)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"model_spec": map[string]interface{}{
+			"name":           m.name,
+			"signature_name": "",
+			"version":        "1",
+		},
+		"metadata": map[string]interface{}{
+			"signature_def": map[string]interface{}{
+				"signature_def": map[string]signatureDef{defaultSignature: sig},
+			},
+		},
+	})
+}
+
+func newTensorInfo(name string, output tf.Output) tensorInfo {
+	if !strings.Contains(name, ":") {
+		name += ":0"
+	}
+	info := tensorInfo{DType: ProtoDataTypeName(output.DataType()), Name: name}
+	shape := output.Shape()
+	if shape.NumDimensions() < 0 {
+		info.TensorShape.UnknownRank = true
+		return info
+	}
+	for i := 0; i < shape.NumDimensions(); i++ {
+		info.TensorShape.Dim = append(info.TensorShape.Dim, tensorShapeDim{Size: fmt.Sprint(shape.Size(i))})
+	}
+	return info
+}
+
+func (s *Server) tfServingPredict(w http.ResponseWriter, r *http.Request, m *servedModel) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	var req predictRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImageSize))
+	dec.UseNumber()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to parse request: %v", err))
+		return
+	}
+	if req.SignatureName != "" && req.SignatureName != defaultSignature {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("serving signature name: %q not found in signature def", req.SignatureName))
+		return
+	}
+
+	row := req.Instances != nil
+	if row == (req.Inputs != nil) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("request must contain exactly one of instances or inputs"))
+		return
+	}
+
+	var (
+		named map[string]interface{}
+		err   error
+	)
+	if row {
+		named, err = m.fromRows(req.Instances)
+	} else {
+		named, err = m.fromColumns(req.Inputs)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	feeds := make(map[string]*tf.Tensor, len(named))
+	for key, v := range named {
+		input, ok := m.model.Input(key)
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("unknown input %q", key))
+			return
+		}
+		t, err := DecodeJSONTensor(v, input.DataType())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("input %q: %v", key, err))
+			return
+		}
+		feeds[key] = t
+	}
+
+	results, err := m.model.RunContext(r.Context(), feeds)
+	if err != nil {
+		writeRunError(w, err)
+		return
+	}
+
+	outputs := make(map[string]interface{}, len(results))
+	for key, t := range results {
+		outputs[key] = EncodeJSONTensor(t)
+	}
+
+	if !row {
+		if len(outputs) == 1 {
+			for _, v := range outputs {
+				writeJSON(w, http.StatusOK, map[string]interface{}{"outputs": v})
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"outputs": outputs})
+		return
+	}
+
+	predictions, err := toRows(outputs)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"predictions": predictions})
+}
+
+// fromRows converts the row format, a list of instances that are either the
+// value of the only input or an object of named inputs, to batched values
+// keyed by input.
+func (m *servedModel) fromRows(instances interface{}) (map[string]interface{}, error) {
+	list, ok := instances.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("instances must be a list")
+	}
+	inputs := m.model.Inputs()
+
+	named := map[string]interface{}{}
+	for i, instance := range list {
+		obj, isObj := instance.(map[string]interface{})
+		if !isObj || isB64(instance) {
+			if len(inputs) != 1 {
+				return nil, fmt.Errorf("instance %d: model has %d inputs, instances must be objects keyed by input name", i, len(inputs))
+			}
+			obj = map[string]interface{}{inputs[0]: instance}
+		}
+		if i > 0 && len(obj) != len(named) {
+			return nil, fmt.Errorf("instance %d: all instances must have the same inputs", i)
+		}
+		for key, v := range obj {
+			batch, _ := named[key].([]interface{})
+			if len(batch) != i {
+				return nil, fmt.Errorf("instance %d: all instances must have the same inputs", i)
+			}
+			named[key] = append(batch, v)
+		}
+	}
+	return named, nil
+}
+
+// fromColumns converts the columnar format, either the value of the only
+// input or an object of named inputs.
+func (m *servedModel) fromColumns(inputs interface{}) (map[string]interface{}, error) {
+	if obj, ok := inputs.(map[string]interface{}); ok && !isB64(inputs) {
+		return obj, nil
+	}
+	keys := m.model.Inputs()
+	if len(keys) != 1 {
+		return nil, fmt.Errorf("model has %d inputs, inputs must be an object keyed by input name", len(keys))
+	}
+	return map[string]interface{}{keys[0]: inputs}, nil
+}
+
+// toRows splits batched outputs into one prediction per instance.
+func toRows(outputs map[string]interface{}) ([]interface{}, error) {
+	batch := -1
+	for key, v := range outputs {
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("output %q has no batch dimension", key)
+		}
+		if batch >= 0 && len(list) != batch {
+			return nil, fmt.Errorf("outputs have different batch sizes")
+		}
+		batch = len(list)
+	}
+
+	if batch < 0 {
+		batch = 0
+	}
+	predictions := make([]interface{}, batch)
+	for i := range predictions {
+		if len(outputs) == 1 {
+			for _, v := range outputs {
+				predictions[i] = v.([]interface{})[i]
+			}
+			continue
+		}
+		row := make(map[string]interface{}, len(outputs))
+		for key, v := range outputs {
+			row[key] = v.([]interface{})[i]
+		}
+		predictions[i] = row
+	}
+	return predictions, nil
+}
+
+// ProtoDataTypeName returns the name of dtype in the DataType proto enum,
+// e.g. DT_FLOAT.
+func ProtoDataTypeName(dtype tf.DataType) string {
+	switch dtype {
+	case tf.Float:
+		return "DT_FLOAT"
+	case tf.Double:
+		return "DT_DOUBLE"
+	case tf.Int8:
+		return "DT_INT8"
+	case tf.Int16:
+		return "DT_INT16"
+	case tf.Int32:
+		return "DT_INT32"
+	case tf.Int64:
+		return "DT_INT64"
+	case tf.Uint8:
+		return "DT_UINT8"
+	case tf.Uint16:
+		return "DT_UINT16"
+	case tf.String:
+		return "DT_STRING"
+	case tf.Bool:
+		return "DT_BOOL"
+	}
+	return "DT_INVALID"
+}
@@ -0,0 +1,501 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	utils "github.com/rai-project/tensorflow-go-examples"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// The open inference protocol (v2) of KServe and Triton, see
+// https://github.com/kserve/kserve/blob/master/docs/predict-api/v2/required_api.md
+// and its binary tensor data extension. Inputs are the placeholders of the
+// graph and outputs the tensors fetched by the manifest, both named as in the
+// graph, e.g. Inputs/mid_his_batch_ph. Manifest keys are accepted as aliases.
+
+// inferHeaderContentLength is the length of the JSON part of a request or
+// response carrying binary tensor data.
+const inferHeaderContentLength = "Inference-Header-Content-Length"
+
+// namedTensor is a graph tensor exposed by name.
+type namedTensor struct {
+	name   string
+	key    string
+	output tf.Output
+}
+
+type v2TensorMetadata struct {
+	Name     string  `json:"name"`
+	Datatype string  `json:"datatype"`
+	Shape    []int64 `json:"shape"`
+}
+
+type v2ModelMetadata struct {
+	Name     string             `json:"name"`
+	Versions []string           `json:"versions"`
+	Platform string             `json:"platform"`
+	Inputs   []v2TensorMetadata `json:"inputs"`
+	Outputs  []v2TensorMetadata `json:"outputs"`
+}
+
+type v2Tensor struct {
+	Name       string                 `json:"name"`
+	Datatype   string                 `json:"datatype"`
+	Shape      []int64                `json:"shape"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	Data       interface{}            `json:"data,omitempty"`
+}
+
+type v2RequestedOutput struct {
+	Name       string                 `json:"name"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+}
+
+type v2InferRequest struct {
+	ID         string                 `json:"id,omitempty"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	Inputs     []v2Tensor             `json:"inputs"`
+	Outputs    []v2RequestedOutput    `json:"outputs,omitempty"`
+}
+
+type v2InferResponse struct {
+	ModelName    string     `json:"model_name"`
+	ModelVersion string     `json:"model_version"`
+	ID           string     `json:"id,omitempty"`
+	Outputs      []v2Tensor `json:"outputs"`
+}
+
+// v2Tensors resolves the tensors exposed by m through the v2 protocol: every
+// placeholder of the graph and the manifest inputs that are not placeholders,
+// then the outputs of the manifest.
+func (m *servedModel) v2Tensors() {
+	seen := map[tf.Output]bool{}
+	keys := map[tf.Output]string{}
+	for _, spec := range m.manifest.Inputs {
+		if output, ok := m.model.Input(spec.Key); ok {
+			keys[output] = spec.Key
+		}
+	}
+	for _, output := range utils.Placeholders(m.model.Graph) {
+		m.inputs = append(m.inputs, namedTensor{name: output.Op.Name(), key: keys[output], output: output})
+		seen[output] = true
+	}
+	for _, spec := range m.manifest.Inputs {
+		output, ok := m.model.Input(spec.Key)
+		if ok && !seen[output] {
+			m.inputs = append(m.inputs, namedTensor{name: spec.Name, key: spec.Key, output: output})
+		}
+	}
+	for _, spec := range m.manifest.Outputs {
+		if output, ok := m.model.Output(spec.Key); ok {
+			m.outputs = append(m.outputs, namedTensor{name: spec.Name, key: spec.Key, output: output})
+		}
+	}
+}
+
+// lookup finds the tensor called name, either its graph name, with or without
+// the ":0" suffix, or its manifest key.
+func lookup(tensors []namedTensor, name string) (namedTensor, bool) {
+	for _, t := range tensors {
+		if t.name == name || t.name+":0" == name || (t.key != "" && t.key == name) {
+			return t, true
+		}
+	}
+	return namedTensor{}, false
+}
+
+func (s *Server) handleV2(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v2"), "/")
+	switch path {
+	case "":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"name":       "tensorflow-go-examples",
+			"version":    "1",
+			"extensions": []string{"binary_tensor_data"},
+		})
+		return
+	case "/health/live":
+		writeJSON(w, http.StatusOK, map[string]bool{"live": true})
+		return
+	case "/health/ready":
+		writeJSON(w, http.StatusOK, map[string]bool{"ready": true})
+		return
+	}
+
+	if !strings.HasPrefix(path, "/models/") {
+		writeError(w, http.StatusNotFound, fmt.Errorf("malformed request: %s %s", r.Method, r.URL.Path))
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(path, "/models/"), "/")
+	name, parts := parts[0], parts[1:]
+	if len(parts) >= 2 && parts[0] == "versions" {
+		parts = parts[2:]
+	}
+
+	m, ok := s.served[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown model: %s", name))
+		return
+	}
+
+	switch {
+	case len(parts) == 0:
+		s.v2Metadata(w, r, m)
+	case len(parts) == 1 && parts[0] == "ready":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"name": m.name, "ready": true})
+	case len(parts) == 1 && parts[0] == "infer":
+		s.v2Infer(w, r, m)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("malformed request: %s %s", r.Method, r.URL.Path))
+	}
+}
+
+func (s *Server) v2Metadata(w http.ResponseWriter, r *http.Request, m *servedModel) {
+	md := v2ModelMetadata{
+		Name:     m.name,
+		Versions: []string{"1"},
+		Platform: "tensorflow_graphdef",
+		Inputs:   []v2TensorMetadata{},
+		Outputs:  []v2TensorMetadata{},
+	}
+	if m.manifest.Format == "saved_model" {
+		md.Platform = "tensorflow_savedmodel"
+	}
+	for _, t := range m.inputs {
+		md.Inputs = append(md.Inputs, newV2TensorMetadata(t))
+	}
+	for _, t := range m.outputs {
+		md.Outputs = append(md.Outputs, newV2TensorMetadata(t))
+	}
+	writeJSON(w, http.StatusOK, md)
+}
+
+func newV2TensorMetadata(t namedTensor) v2TensorMetadata {
+	md := v2TensorMetadata{Name: t.name, Datatype: V2DataTypeName(t.output.DataType())}
+	shape := t.output.Shape()
+	if shape.NumDimensions() < 0 {
+		// The protocol has no notation for an unknown rank.
+		md.Shape = []int64{-1}
+		return md
+	}
+	md.Shape = make([]int64, shape.NumDimensions())
+	for i := range md.Shape {
+		md.Shape[i] = shape.Size(i)
+	}
+	return md
+}
+
+func (s *Server) v2Infer(w http.ResponseWriter, r *http.Request, m *servedModel) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxImageSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	header, data := body, []byte(nil)
+	if v := r.Header.Get(inferHeaderContentLength); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > len(body) {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s %q", inferHeaderContentLength, v))
+			return
+		}
+		header, data = body[:n], body[n:]
+	}
+
+	var req v2InferRequest
+	dec := json.NewDecoder(bytes.NewReader(header))
+	dec.UseNumber()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to parse request: %v", err))
+		return
+	}
+
+	feeds := make(map[tf.Output]*tf.Tensor, len(req.Inputs))
+	for _, in := range req.Inputs {
+		t, ok := lookup(m.inputs, in.Name)
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("unexpected inference input %q for model %q", in.Name, m.name))
+			return
+		}
+		dtype := t.output.DataType()
+		if in.Datatype != V2DataTypeName(dtype) {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("input %q: expected datatype %s, got %s", in.Name, V2DataTypeName(dtype), in.Datatype))
+			return
+		}
+
+		var tensor *tf.Tensor
+		if size, ok := in.Parameters["binary_data_size"]; ok {
+			n, nerr := intValue(size)
+			if nerr != nil || n > len(data) {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("input %q: invalid binary_data_size %v", in.Name, size))
+				return
+			}
+			tensor, err = decodeBinaryTensor(data[:n], dtype, in.Shape)
+			data = data[n:]
+		} else {
+			tensor, err = decodeV2Tensor(in.Data, dtype, in.Shape)
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("input %q: %v", in.Name, err))
+			return
+		}
+		feeds[t.output] = tensor
+	}
+	if len(data) != 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%d bytes of binary data are not used by any input", len(data)))
+		return
+	}
+
+	// Outputs default to every output of the manifest, in JSON unless the
+	// request asks for binary data.
+	binaryDefault, _ := req.Parameters["binary_data_output"].(bool)
+	requested := req.Outputs
+	if len(requested) == 0 {
+		for _, t := range m.outputs {
+			requested = append(requested, v2RequestedOutput{Name: t.name})
+		}
+	}
+	fetches := make([]tf.Output, len(requested))
+	for i, out := range requested {
+		t, ok := lookup(m.outputs, out.Name)
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("unexpected inference output %q for model %q", out.Name, m.name))
+			return
+		}
+		fetches[i] = t.output
+	}
+
+	results, err := m.model.RunGraph(r.Context(), feeds, fetches)
+	if err != nil {
+		writeRunError(w, err)
+		return
+	}
+
+	resp := v2InferResponse{ModelName: m.name, ModelVersion: "1", ID: req.ID}
+	var payload bytes.Buffer
+	for i, out := range requested {
+		t := results[i]
+		tensor := v2Tensor{Name: out.Name, Datatype: V2DataTypeName(t.DataType()), Shape: t.Shape()}
+		if tensor.Shape == nil {
+			tensor.Shape = []int64{}
+		}
+		binaryData, ok := out.Parameters["binary_data"].(bool)
+		if !ok {
+			binaryData = binaryDefault
+		}
+		if binaryData {
+			n, err := encodeBinaryTensor(&payload, t)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			tensor.Parameters = map[string]interface{}{"binary_data_size": n}
+		} else {
+			tensor.Data = jsonValues(t)
+		}
+		resp.Outputs = append(resp.Outputs, tensor)
+	}
+
+	if payload.Len() == 0 {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	b, err := json.Marshal(resp)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set(inferHeaderContentLength, strconv.Itoa(len(b)))
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)+payload.Len()))
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+	w.Write(payload.Bytes())
+}
+
+// decodeV2Tensor converts the data of a v2 tensor, a flat or nested list of
+// values in row-major order, to a tensor of the given shape.
+func decodeV2Tensor(data interface{}, dtype tf.DataType, shape []int64) (*tf.Tensor, error) {
+	var leaves []interface{}
+	flattenJSON(data, &leaves)
+	n, err := numElements(shape, int64(len(leaves)))
+	if err != nil {
+		return nil, err
+	}
+	if n != int64(len(leaves)) {
+		return nil, fmt.Errorf("%d values do not fit shape %v", len(leaves), shape)
+	}
+	flat, err := convertLeaves(leaves, dtype)
+	if err != nil {
+		return nil, err
+	}
+	return utils.ReshapeTensor(flat, shape)
+}
+
+func flattenJSON(v interface{}, leaves *[]interface{}) {
+	list, ok := v.([]interface{})
+	if !ok {
+		if v != nil {
+			*leaves = append(*leaves, v)
+		}
+		return
+	}
+	for _, e := range list {
+		flattenJSON(e, leaves)
+	}
+}
+
+// decodeBinaryTensor decodes the binary tensor data extension: values in
+// row-major little-endian order, BYTES elements prefixed with their 4-byte
+// length.
+func decodeBinaryTensor(b []byte, dtype tf.DataType, shape []int64) (*tf.Tensor, error) {
+	// Every element takes at least a byte, or the 4 bytes of its length for
+	// BYTES, which bounds the shapes accepted before anything is allocated.
+	n, err := numElements(shape, int64(len(b)))
+	if err != nil {
+		return nil, err
+	}
+	if dtype != tf.String {
+		size, ok := dataTypeSizes[dtype]
+		if !ok {
+			return nil, fmt.Errorf("unsupported datatype %s", V2DataTypeName(dtype))
+		}
+		if n*size != int64(len(b)) {
+			return nil, fmt.Errorf("%d bytes do not fit shape %v of %s", len(b), shape, V2DataTypeName(dtype))
+		}
+		return tf.ReadTensor(dtype, shape, bytes.NewReader(b))
+	}
+	strs := make([]string, 0, n)
+	for len(b) != 0 {
+		if len(b) < 4 {
+			return nil, fmt.Errorf("truncated BYTES element")
+		}
+		n := binary.LittleEndian.Uint32(b)
+		b = b[4:]
+		if uint32(len(b)) < n {
+			return nil, fmt.Errorf("truncated BYTES element")
+		}
+		strs = append(strs, string(b[:n]))
+		b = b[n:]
+	}
+	if int64(len(strs)) != n {
+		return nil, fmt.Errorf("%d BYTES elements do not fit shape %v", len(strs), shape)
+	}
+	return utils.ReshapeTensor(strs, shape)
+}
+
+// dataTypeSizes are the sizes in bytes of the elements of the fixed-size
+// types.
+var dataTypeSizes = map[tf.DataType]int64{
+	tf.Bool:   1,
+	tf.Uint8:  1,
+	tf.Uint16: 2,
+	tf.Uint32: 4,
+	tf.Uint64: 8,
+	tf.Int8:   1,
+	tf.Int16:  2,
+	tf.Int32:  4,
+	tf.Int64:  8,
+	tf.Half:   2,
+	tf.Float:  4,
+	tf.Double: 8,
+}
+
+// numElements returns the number of elements of a tensor of the given shape.
+// It fails on negative dimensions and on shapes of more than max elements, so
+// that client shapes cannot make huge allocations.
+func numElements(shape []int64, max int64) (int64, error) {
+	for _, dim := range shape {
+		if dim < 0 {
+			return 0, fmt.Errorf("invalid shape %v", shape)
+		}
+	}
+	for _, dim := range shape {
+		if dim == 0 {
+			return 0, nil
+		}
+	}
+	n := int64(1)
+	for _, dim := range shape {
+		if n > max/dim {
+			return 0, fmt.Errorf("shape %v has too many elements", shape)
+		}
+		n *= dim
+	}
+	return n, nil
+}
+
+// encodeBinaryTensor appends t to buf in the binary tensor data format and
+// returns the number of bytes written.
+func encodeBinaryTensor(buf *bytes.Buffer, t *tf.Tensor) (int, error) {
+	start := buf.Len()
+	if t.DataType() != tf.String {
+		_, err := t.WriteContentsTo(buf)
+		return buf.Len() - start, err
+	}
+	var size [4]byte
+	for _, s := range utils.FlattenTensor(t).([]string) {
+		binary.LittleEndian.PutUint32(size[:], uint32(len(s)))
+		buf.Write(size[:])
+		buf.WriteString(s)
+	}
+	return buf.Len() - start, nil
+}
+
+func intValue(v interface{}) (int, error) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("expected a number, got %v", v)
+	}
+	i, err := strconv.Atoi(string(n))
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid size %v", v)
+	}
+	return i, nil
+}
+
+// V2DataTypeName returns the name of dtype in the v2 inference protocol, e.g.
+// FP32.
+func V2DataTypeName(dtype tf.DataType) string {
+	switch dtype {
+	case tf.Bool:
+		return "BOOL"
+	case tf.Uint8:
+		return "UINT8"
+	case tf.Uint16:
+		return "UINT16"
+	case tf.Uint32:
+		return "UINT32"
+	case tf.Uint64:
+		return "UINT64"
+	case tf.Int8:
+		return "INT8"
+	case tf.Int16:
+		return "INT16"
+	case tf.Int32:
+		return "INT32"
+	case tf.Int64:
+		return "INT64"
+	case tf.Half:
+		return "FP16"
+	case tf.Float:
+		return "FP32"
+	case tf.Double:
+		return "FP64"
+	case tf.String:
+		return "BYTES"
+	}
+	return "INVALID"
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+func TestV2InferInvalidInputs(t *testing.T) {
+	s := op.NewScope()
+	x := op.Placeholder(s.SubScope("x"), tf.Float)
+	if _, err := s.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+	// Every request fails before the model is run, so there is none.
+	srv := &Server{served: map[string]*servedModel{
+		"m": {name: "m", inputs: []namedTensor{{name: "x", output: x}}},
+	}}
+
+	tests := []struct {
+		name   string
+		header string
+		data   []byte
+	}{
+		{"binary of the wrong size", `{"inputs": [{"name": "x", "datatype": "FP32", "shape": [2], "parameters": {"binary_data_size": 4}}]}`, make([]byte, 4)},
+		{"binary size past the data", `{"inputs": [{"name": "x", "datatype": "FP32", "shape": [1], "parameters": {"binary_data_size": 8}}]}`, make([]byte, 4)},
+		{"negative binary size", `{"inputs": [{"name": "x", "datatype": "FP32", "shape": [1], "parameters": {"binary_data_size": -4}}]}`, make([]byte, 4)},
+		{"unused binary data", `{"inputs": [{"name": "x", "datatype": "FP32", "shape": [1], "parameters": {"binary_data_size": 4}}]}`, make([]byte, 8)},
+		{"values of the wrong shape", `{"inputs": [{"name": "x", "datatype": "FP32", "shape": [3], "data": [1, 2]}]}`, nil},
+		{"negative shape", `{"inputs": [{"name": "x", "datatype": "FP32", "shape": [-1], "data": [1]}]}`, nil},
+		{"wrong datatype", `{"inputs": [{"name": "x", "datatype": "INT32", "shape": [1], "data": [1]}]}`, nil},
+		{"unknown input", `{"inputs": [{"name": "y", "datatype": "FP32", "shape": [1], "data": [1]}]}`, nil},
+	}
+	for _, tt := range tests {
+		body := append([]byte(tt.header), tt.data...)
+		r := httptest.NewRequest(http.MethodPost, "/v2/models/m/infer", bytes.NewReader(body))
+		if tt.data != nil {
+			r.Header.Set(inferHeaderContentLength, strconv.Itoa(len(tt.header)))
+		}
+		w := httptest.NewRecorder()
+		srv.handleV2(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, http.StatusBadRequest, w.Body)
+		}
+	}
+}
+
+func TestNumElements(t *testing.T) {
+	tests := []struct {
+		shape []int64
+		max   int64
+		want  int64
+		ok    bool
+	}{
+		{[]int64{}, 10, 1, true},
+		{[]int64{2, 3}, 10, 6, true},
+		{[]int64{0, 1 << 40}, 10, 0, true},
+		{[]int64{2, -1}, 10, 0, false},
+		{[]int64{0, -1}, 10, 0, false},
+		{[]int64{4, 3}, 10, 0, false},
+		{[]int64{1 << 40, 1 << 40}, 1 << 62, 0, false},
+	}
+	for _, tt := range tests {
+		n, err := numElements(tt.shape, tt.max)
+		if (err == nil) != tt.ok || n != tt.want {
+			t.Errorf("numElements(%v, %d) = %d, %v, want %d, ok %v", tt.shape, tt.max, n, err, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package task
+
+import (
+	"context"
+	"image"
+
+	utils "github.com/rai-project/tensorflow-go-examples"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// Classifier runs an image classification model such as MobileNet.
+type Classifier struct {
+	Model    *utils.Model
+	Manifest *utils.Manifest
+	Labels   []string
+}
+
+// NewClassifier loads the model described by manifest from dir.
+func NewClassifier(manifest *utils.Manifest, dir string, options *tf.SessionOptions) (*Classifier, error) {
+	labels, err := manifest.LoadLabels()
+	if err != nil {
+		return nil, err
+	}
+	model, err := manifest.Load(dir, options)
+	if err != nil {
+		return nil, err
+	}
+	return &Classifier{Model: model, Manifest: manifest, Labels: labels}, nil
+}
+
+// Classify returns the predictions for img sorted by decreasing probability.
+func (c *Classifier) Classify(img image.Image) (utils.Predictions, error) {
+	return c.ClassifyContext(context.Background(), img)
+}
+
+// ClassifyContext is like Classify but returns early with the error of ctx
+// if ctx is done before the model has run.
+func (c *Classifier) ClassifyContext(ctx context.Context, img image.Image) (utils.Predictions, error) {
+	return c.TopKContext(ctx, img, 0)
+}
+
+// TopK returns the k most probable classes of img sorted by decreasing
+// probability, every class if k is not positive.
+func (c *Classifier) TopK(img image.Image, k int) (utils.Predictions, error) {
+	return c.TopKContext(context.Background(), img, k)
+}
+
+// TopKContext is like TopK but returns early with the error of ctx if ctx
+// is done before the model has run.
+func (c *Classifier) TopKContext(ctx context.Context, img image.Image, k int) (utils.Predictions, error) {
+	tensor, err := c.Manifest.Preprocessing.Tensor(img, inputType(c.Manifest, "images", tf.Float))
+	if err != nil {
+		return utils.Predictions{}, err
+	}
+
+	results, err := c.Model.RunContext(ctx, map[string]*tf.Tensor{
+		"images": tensor,
+	})
+	if err != nil {
+		return utils.Predictions{}, err
+	}
+	probs, err := output(results, "probabilities")
+	if err != nil {
+		return utils.Predictions{}, err
+	}
+
+	// Take the first in the batched output
+	return utils.TopK(probs.Value().([][]float32)[0], k), nil
+}
+
+// Label returns the label of class index, or "" if there is none.
+func (c *Classifier) Label(index int) string {
+	if index < 0 || index >= len(c.Labels) {
+		return ""
+	}
+	return c.Labels[index]
+}
+
+// Classification labels preds, the predictions for the image at path.
+func (c *Classifier) Classification(path string, preds utils.Predictions) utils.Classification {
+	return preds.Classification(path, c.Labels)
+}
+
+// Close releases the model.
+func (c *Classifier) Close() error {
+	return c.Model.Close()
+}
@@ -0,0 +1,184 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	utils "github.com/rai-project/tensorflow-go-examples"
+	"github.com/rai-project/tensorflow-go-examples/dien/data"
+	"github.com/rai-project/tensorflow-go-examples/dien/metrics"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// CTRScorer runs the DIEN click-through rate model.
+type CTRScorer struct {
+	Model    *utils.Model
+	Manifest *utils.Manifest
+
+	// Dataset holds the vocabularies Rank maps raw ids through, and the
+	// categories of the items.
+	Dataset *data.Dataset
+	// MaxLen, if positive, is the length Rank truncates histories to.
+	MaxLen int
+	// ClickColumn is the column of the softmax output Rank ranks by, 1 as
+	// set by NewCTRScorer. Graphs trained by the AI Matrix scripts against
+	// [click, 1-click] targets put the click probability in column 0.
+	ClickColumn int
+}
+
+// NewCTRScorer loads the model described by manifest from dir.
+func NewCTRScorer(manifest *utils.Manifest, dir string, options *tf.SessionOptions) (*CTRScorer, error) {
+	model, err := manifest.Load(dir, options)
+	if err != nil {
+		return nil, err
+	}
+	return &CTRScorer{Model: model, Manifest: manifest, ClickColumn: 1}, nil
+}
+
+// CTROutput holds the outputs of the model for a batch.
+type CTROutput struct {
+	// Probabilities is the softmax output for every sample.
+	Probabilities [][]float32
+	// AuxLoss is the auxiliary loss of the batch, 0 unless the scorer
+	// HasAuxLoss.
+	AuxLoss float32
+}
+
+// TakesNoClk reports whether the model is fed the no-click histories and the
+// target of the batches, the inputs of its auxiliary loss. Their batches
+// must be read with data.BatchOptions.NegSamples set.
+func (c *CTRScorer) TakesNoClk() bool {
+	for _, key := range []string{"noclk_mid_his", "noclk_cat_his", "target"} {
+		if _, ok := c.Model.Input(key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAuxLoss reports whether the manifest declares the "aux_loss" output.
+func (c *CTRScorer) HasAuxLoss() bool {
+	_, ok := c.Model.Output("aux_loss")
+	return ok
+}
+
+// Score returns the softmax output of the model for every sample of batch.
+func (c *CTRScorer) Score(batch *data.Batch) ([][]float32, error) {
+	return c.ScoreContext(context.Background(), batch)
+}
+
+// ScoreContext is like Score but returns early with the error of ctx
+// if ctx is done before the model has run.
+func (c *CTRScorer) ScoreContext(ctx context.Context, batch *data.Batch) ([][]float32, error) {
+	out, err := c.RunContext(ctx, batch)
+	if err != nil {
+		return nil, err
+	}
+	return out.Probabilities, nil
+}
+
+// Feeds returns the inputs of the model for batch, including the no-click
+// histories and the target the model declares if it TakesNoClk.
+func (c *CTRScorer) Feeds(batch *data.Batch) (map[string]*tf.Tensor, error) {
+	feeds, err := batch.Tensors()
+	if err != nil || !c.TakesNoClk() {
+		return feeds, err
+	}
+	aux, err := batch.AuxTensors()
+	if err != nil {
+		return nil, err
+	}
+	for key, t := range aux {
+		if _, ok := c.Model.Input(key); ok {
+			feeds[key] = t
+		}
+	}
+	return feeds, nil
+}
+
+// RunContext runs the model on batch and returns its softmax output and,
+// if the model has one, its auxiliary loss.
+func (c *CTRScorer) RunContext(ctx context.Context, batch *data.Batch) (*CTROutput, error) {
+	feeds, err := c.Feeds(batch)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := c.Model.RunContext(ctx, feeds)
+	if err != nil {
+		return nil, err
+	}
+	probs, err := output(results, "probabilities")
+	if err != nil {
+		return nil, err
+	}
+	out := &CTROutput{Probabilities: probs.Value().([][]float32)}
+	if c.HasAuxLoss() {
+		loss, err := output(results, "aux_loss")
+		if err != nil {
+			return nil, err
+		}
+		v, ok := loss.Value().(float32)
+		if !ok {
+			return nil, fmt.Errorf("aux_loss is a %v tensor of shape %v, want a float scalar", loss.DataType(), loss.Shape())
+		}
+		out.AuxLoss = v
+	}
+	return out, nil
+}
+
+// CTREvaluation holds the test metrics of a model and its throughput.
+type CTREvaluation struct {
+	metrics.Result
+	// Seconds is the time spent running the model.
+	Seconds       float64 `json:"seconds"`
+	SamplesPerSec float64 `json:"samples_per_sec"`
+}
+
+// Evaluate scores every batch of batches until it returns io.EOF, and
+// computes the metrics of the AI Matrix test script.
+func (c *CTRScorer) Evaluate(batches *data.Batches) (*CTREvaluation, error) {
+	return c.EvaluateContext(context.Background(), batches)
+}
+
+// EvaluateContext is like Evaluate but returns early with the error of ctx
+// if ctx is done before every batch has run.
+func (c *CTRScorer) EvaluateContext(ctx context.Context, batches *data.Batches) (*CTREvaluation, error) {
+	var acc metrics.Accumulator
+	var elapsed time.Duration
+	for {
+		samples, err := batches.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		batch := data.NewBatch(samples, batches.MaxLen())
+		start := time.Now()
+		out, err := c.RunContext(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		elapsed += time.Since(start)
+		if err := acc.Add(out.Probabilities, batch.Target()); err != nil {
+			return nil, err
+		}
+		if c.HasAuxLoss() {
+			acc.AddAuxLoss(float64(out.AuxLoss))
+		}
+	}
+
+	e := &CTREvaluation{Result: acc.Result(), Seconds: elapsed.Seconds()}
+	if e.Seconds > 0 {
+		e.SamplesPerSec = float64(e.Samples) / e.Seconds
+	}
+	return e, nil
+}
+
+// Close releases the model.
+func (c *CTRScorer) Close() error {
+	return c.Model.Close()
+}
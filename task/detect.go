@@ -0,0 +1,153 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+
+	utils "github.com/rai-project/tensorflow-go-examples"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"golang.org/x/image/colornames"
+)
+
+// Detection is one object found by a Detector. Box holds the normalized
+// [yMin, xMin, yMax, xMax] coordinates of the object. Mask is only set by
+// instance segmentation models.
+type Detection struct {
+	Class int         `json:"class"`
+	Label string      `json:"label,omitempty"`
+	Score float32     `json:"score"`
+	Box   [4]float32  `json:"box"`
+	Mask  [][]float32 `json:"-"`
+}
+
+// Detector runs an object detection or instance segmentation model from the
+// TensorFlow detection model zoo.
+type Detector struct {
+	Model     *utils.Model
+	Manifest  *utils.Manifest
+	Labels    []string
+	Threshold float32
+}
+
+// NewDetector loads the model described by manifest from dir. Detections
+// scoring below threshold are dropped.
+func NewDetector(manifest *utils.Manifest, dir string, threshold float32, options *tf.SessionOptions) (*Detector, error) {
+	labels, err := manifest.LoadLabels()
+	if err != nil {
+		return nil, err
+	}
+	model, err := manifest.Load(dir, options)
+	if err != nil {
+		return nil, err
+	}
+	return &Detector{Model: model, Manifest: manifest, Labels: labels, Threshold: threshold}, nil
+}
+
+// Detect returns the objects found in img, ordered by decreasing score.
+func (d *Detector) Detect(img image.Image) ([]Detection, error) {
+	return d.DetectContext(context.Background(), img)
+}
+
+// DetectContext is like Detect but returns early with the error of ctx
+// if ctx is done before the model has run.
+func (d *Detector) DetectContext(ctx context.Context, img image.Image) ([]Detection, error) {
+	tensor, err := d.Manifest.Preprocessing.Tensor(img, inputType(d.Manifest, "images", tf.Uint8))
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := d.Model.RunContext(ctx, map[string]*tf.Tensor{
+		"images": tensor,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d.detections(results, 0)
+}
+
+// detections extracts the detections of image n of a batched result.
+func (d *Detector) detections(results map[string]*tf.Tensor, n int) ([]Detection, error) {
+	boxesTensor, err := output(results, "boxes")
+	if err != nil {
+		return nil, err
+	}
+	scoresTensor, err := output(results, "scores")
+	if err != nil {
+		return nil, err
+	}
+	classesTensor, err := output(results, "classes")
+	if err != nil {
+		return nil, err
+	}
+
+	boxes := boxesTensor.Value().([][][]float32)[n]
+	scores := scoresTensor.Value().([][]float32)[n]
+	classes := classesTensor.Value().([][]float32)[n]
+
+	count := len(scores)
+	if num, ok := results["num_detections"]; ok {
+		count = int(num.Value().([]float32)[n])
+	}
+	var masks [][][]float32
+	if m, ok := results["masks"]; ok {
+		masks = m.Value().([][][][]float32)[n]
+	}
+
+	var detections []Detection
+	for i := 0; i < count && i < len(scores); i++ {
+		if scores[i] < d.Threshold {
+			continue
+		}
+		det := Detection{
+			Class: int(classes[i]),
+			Score: scores[i],
+			Box:   [4]float32{boxes[i][0], boxes[i][1], boxes[i][2], boxes[i][3]},
+		}
+		if det.Class >= 0 && det.Class < len(d.Labels) {
+			det.Label = d.Labels[det.Class]
+		}
+		if i < len(masks) {
+			det.Mask = masks[i]
+		}
+		detections = append(detections, det)
+	}
+	return detections, nil
+}
+
+// Close releases the model.
+func (d *Detector) Close() error {
+	return d.Model.Close()
+}
+
+// DrawDetections draws the box, label and mask of every detection onto a
+// copy of img.
+func DrawDetections(img image.Image, detections []Detection) *image.RGBA {
+	// Transform the decoded image into RGBA
+	b := img.Bounds()
+	out := image.NewRGBA(b)
+	draw.Draw(out, b, img, b.Min, draw.Src)
+
+	for _, det := range detections {
+		y1 := float32(out.Bounds().Max.Y) * det.Box[0]
+		x1 := float32(out.Bounds().Max.X) * det.Box[1]
+		y2 := float32(out.Bounds().Max.Y) * det.Box[2]
+		x2 := float32(out.Bounds().Max.X) * det.Box[3]
+
+		color := colornames.Map[colornames.Names[det.Class%len(colornames.Names)]]
+
+		label := det.Label
+		if label == "" {
+			label = fmt.Sprint(det.Class)
+		}
+		label = fmt.Sprintf("%s (%2.0f%%)", label, det.Score*100.0)
+
+		utils.Rect(out, int(x1), int(y1), int(x2), int(y2), 4, color)
+		utils.AddLabel(out, int(x1), int(y1), det.Class%len(colornames.Names), label)
+		if det.Mask != nil {
+			out = utils.Segment(out, det.Mask, color, x1, y1, x2, y2)
+		}
+	}
+	return out
+}
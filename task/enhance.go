@@ -0,0 +1,73 @@
+package task
+
+import (
+	"context"
+	"image"
+	"image/color"
+
+	utils "github.com/rai-project/tensorflow-go-examples"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// Enhancer runs an image super resolution model such as SRGAN.
+type Enhancer struct {
+	Model    *utils.Model
+	Manifest *utils.Manifest
+}
+
+// NewEnhancer loads the model described by manifest from dir.
+func NewEnhancer(manifest *utils.Manifest, dir string, options *tf.SessionOptions) (*Enhancer, error) {
+	model, err := manifest.Load(dir, options)
+	if err != nil {
+		return nil, err
+	}
+	return &Enhancer{Model: model, Manifest: manifest}, nil
+}
+
+// Enhance returns the high resolution version of img.
+func (e *Enhancer) Enhance(img image.Image) (image.Image, error) {
+	return e.EnhanceContext(context.Background(), img)
+}
+
+// EnhanceContext is like Enhance but returns early with the error of ctx
+// if ctx is done before the model has run.
+func (e *Enhancer) EnhanceContext(ctx context.Context, img image.Image) (image.Image, error) {
+	tensor, err := e.Manifest.Preprocessing.Tensor(img, inputType(e.Manifest, "images", tf.Float))
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := e.Model.RunContext(ctx, map[string]*tf.Tensor{
+		"images": tensor,
+	})
+	if err != nil {
+		return nil, err
+	}
+	enhanced, err := output(results, "enhanced")
+	if err != nil {
+		return nil, err
+	}
+
+	// Take the first in the batched output
+	return imageFromTanh(enhanced.Value().([][][][]float32)[0]), nil
+}
+
+// Close releases the model.
+func (e *Enhancer) Close() error {
+	return e.Model.Close()
+}
+
+// imageFromTanh converts HWC pixel values in [-1, 1] into an image.
+func imageFromTanh(input [][][]float32) *image.RGBA {
+	height, width := len(input), len(input[0])
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	var R, G, B uint8
+	for w := 0; w < width; w++ {
+		for h := 0; h < height; h++ {
+			R, G, B = uint8((input[h][w][0]+1)*127.5), uint8((input[h][w][1]+1)*127.5), uint8((input[h][w][2]+1)*127.5)
+			img.Set(w, h, color.RGBA{R, G, B, 255})
+		}
+	}
+	return img
+}
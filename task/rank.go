@@ -0,0 +1,118 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/rai-project/tensorflow-go-examples/dien/data"
+)
+
+// CTRRequest asks for the candidate items of a user to be ranked by click
+// probability. Ids are the raw keys of the dataset, mapped through the
+// vocabularies of the scorer; unknown keys map to 0 like in training.
+type CTRRequest struct {
+	UID        string         `json:"uid"`
+	Candidates []CTRCandidate `json:"candidates"`
+	// MIDHistory and CatHistory are the items the user recently clicked,
+	// oldest first, and their categories. CatHistory may be left out to look
+	// the categories up in item-info.
+	MIDHistory []string `json:"mid_history"`
+	CatHistory []string `json:"cat_history,omitempty"`
+}
+
+// CTRCandidate is an item to rank and its category. The category may be left
+// out to look it up in item-info.
+type CTRCandidate struct {
+	MID string `json:"mid"`
+	Cat string `json:"cat,omitempty"`
+}
+
+// Validate checks that req has candidates and, if it has categories for its
+// history, one per item.
+func (req *CTRRequest) Validate() error {
+	if len(req.Candidates) == 0 {
+		return fmt.Errorf("no candidates")
+	}
+	for i, cand := range req.Candidates {
+		if cand.MID == "" {
+			return fmt.Errorf("candidate %d has no mid", i)
+		}
+	}
+	if req.CatHistory != nil && len(req.CatHistory) != len(req.MIDHistory) {
+		return fmt.Errorf("%d items but %d categories in the history", len(req.MIDHistory), len(req.CatHistory))
+	}
+	return nil
+}
+
+// RankedItem is a candidate and its click probability.
+type RankedItem struct {
+	CTRCandidate
+	Probability float32 `json:"probability"`
+}
+
+// Rank scores every candidate of req in one run of the model and returns
+// them by decreasing click probability.
+func (c *CTRScorer) Rank(req *CTRRequest) ([]RankedItem, error) {
+	return c.RankContext(context.Background(), req)
+}
+
+// RankContext is like Rank but returns early with the error of ctx if ctx is
+// done before the model has run.
+func (c *CTRScorer) RankContext(ctx context.Context, req *CTRRequest) ([]RankedItem, error) {
+	if c.Dataset == nil {
+		return nil, fmt.Errorf("no vocabularies to map the ids of the request")
+	}
+	if c.TakesNoClk() {
+		return nil, fmt.Errorf("the model takes no-click histories, serve an inference graph")
+	}
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	ds := c.Dataset
+
+	midHis := make([]int32, len(req.MIDHistory))
+	catHis := make([]int32, len(req.MIDHistory))
+	for i, mid := range req.MIDHistory {
+		midHis[i] = ds.MID.ID(mid)
+		catHis[i] = ds.ItemCat[midHis[i]]
+	}
+	for i, cat := range req.CatHistory {
+		catHis[i] = ds.Cat.ID(cat)
+	}
+	if len(midHis) == 0 {
+		// Like the AI Matrix data iterator, an empty history is a single
+		// unknown item.
+		midHis, catHis = []int32{0}, []int32{0}
+	}
+
+	uid := ds.UID.ID(req.UID)
+	samples := make([]data.Sample, len(req.Candidates))
+	for i, cand := range req.Candidates {
+		mid := ds.MID.ID(cand.MID)
+		cat := ds.ItemCat[mid]
+		if cand.Cat != "" {
+			cat = ds.Cat.ID(cand.Cat)
+		}
+		samples[i] = data.Sample{UID: uid, MID: mid, Cat: cat, MIDHis: midHis, CatHis: catHis}
+	}
+
+	probs, err := c.ScoreContext(ctx, data.NewBatch(samples, c.MaxLen))
+	if err != nil {
+		return nil, err
+	}
+	if len(probs) != len(req.Candidates) {
+		return nil, fmt.Errorf("%d outputs for %d candidates", len(probs), len(req.Candidates))
+	}
+	ranked := make([]RankedItem, len(req.Candidates))
+	for i, cand := range req.Candidates {
+		if c.ClickColumn < 0 || c.ClickColumn >= len(probs[i]) {
+			return nil, fmt.Errorf("softmax output has %d columns, no column %d", len(probs[i]), c.ClickColumn)
+		}
+		ranked[i] = RankedItem{CTRCandidate: cand, Probability: probs[i][c.ClickColumn]}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Probability > ranked[j].Probability
+	})
+	return ranked, nil
+}
@@ -0,0 +1,124 @@
+package task
+
+import (
+	"context"
+	"image"
+	"image/color"
+
+	"github.com/disintegration/imaging"
+	utils "github.com/rai-project/tensorflow-go-examples"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// PascalLabelNames are the classes predicted by DeepLab models trained on
+// PASCAL VOC 2012.
+var PascalLabelNames = []string{"background", "aeroplane", "bicycle", "bird", "boat", "bottle", "bus",
+	"car", "cat", "chair", "cow", "diningtable", "dog", "horse", "motorbike", "person", "pottedplant",
+	"sheep", "sofa", "train", "tv"}
+
+// Segmentation is the class of every pixel of an image resized to the input
+// size of the model.
+type Segmentation struct {
+	Width   int
+	Height  int
+	Classes [][]int64
+	Image   image.Image
+}
+
+// SemanticSegmenter runs a semantic segmentation model such as DeepLab.
+type SemanticSegmenter struct {
+	Model    *utils.Model
+	Manifest *utils.Manifest
+}
+
+// NewSemanticSegmenter loads the model described by manifest from dir.
+func NewSemanticSegmenter(manifest *utils.Manifest, dir string, options *tf.SessionOptions) (*SemanticSegmenter, error) {
+	model, err := manifest.Load(dir, options)
+	if err != nil {
+		return nil, err
+	}
+	return &SemanticSegmenter{Model: model, Manifest: manifest}, nil
+}
+
+// Segment returns the class of every pixel of img.
+func (s *SemanticSegmenter) Segment(img image.Image) (*Segmentation, error) {
+	return s.SegmentContext(context.Background(), img)
+}
+
+// SegmentContext is like Segment but returns early with the error of ctx
+// if ctx is done before the model has run.
+func (s *SemanticSegmenter) SegmentContext(ctx context.Context, img image.Image) (*Segmentation, error) {
+	resized := s.Manifest.Preprocessing.Apply(img)
+	tensor, err := utils.Preprocessing{}.Tensor(resized, inputType(s.Manifest, "images", tf.Uint8))
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := s.Model.RunContext(ctx, map[string]*tf.Tensor{
+		"images": tensor,
+	})
+	if err != nil {
+		return nil, err
+	}
+	seg, err := output(results, "segmentation")
+	if err != nil {
+		return nil, err
+	}
+
+	// Take the first in the batched output
+	classes := seg.Value().([][][]int64)[0]
+	return &Segmentation{
+		Width:   resized.Bounds().Dx(),
+		Height:  resized.Bounds().Dy(),
+		Classes: classes,
+		Image:   resized,
+	}, nil
+}
+
+// Close releases the model.
+func (s *SemanticSegmenter) Close() error {
+	return s.Model.Close()
+}
+
+// Mask colors every pixel by its class using the PASCAL color map. Background
+// pixels are transparent.
+func (s *Segmentation) Mask() *image.RGBA {
+	colorMap := PascalLabelColorMap()
+	mask := image.NewRGBA(image.Rect(0, 0, s.Width, s.Height))
+	for w := 0; w < s.Width; w++ {
+		for h := 0; h < s.Height; h++ {
+			v := s.Classes[h][w]
+			if v > 0 && v < int64(len(colorMap)) {
+				R, G, B := uint8(colorMap[v][0]), uint8(colorMap[v][1]), uint8(colorMap[v][2])
+				mask.Set(w, h, color.RGBA{R, G, B, 255})
+			}
+		}
+	}
+	return mask
+}
+
+// Overlay blends the colored mask over the segmented image.
+func (s *Segmentation) Overlay() image.Image {
+	return imaging.Overlay(s.Image, s.Mask(), image.ZP, 0.7)
+}
+
+// PascalLabelColorMap returns the color map used to visualize PASCAL VOC
+// segmentation results.
+func PascalLabelColorMap() [256][3]int32 {
+	var colorMap [256][3]int32
+	var ind [256]int32
+	for ii := 0; ii < 256; ii++ {
+		ind[ii] = int32(ii)
+	}
+	for shift := 7; shift >= 0; shift-- {
+		for jj := 0; jj < 256; jj++ {
+			for kk := 0; kk < 3; kk++ {
+				colorMap[jj][kk] |= ((ind[jj] >> uint(kk)) & 1) << uint(shift)
+			}
+		}
+		for jj := range ind {
+			ind[jj] >>= 3
+		}
+	}
+	return colorMap
+}
@@ -0,0 +1,67 @@
+// Package task implements the inference pipelines of the examples on top of
+// utils.Model, so that they can be shared by the tfgo command and the server.
+package task
+
+import (
+	"fmt"
+	"path/filepath"
+
+	utils "github.com/rai-project/tensorflow-go-examples"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// Names of the tasks.
+const (
+	Classify         = "classify"
+	Detect           = "detect"
+	SegmentInstances = "segment-instances"
+	SegmentSemantic  = "segment-semantic"
+	Enhance          = "enhance"
+	CTR              = "ctr"
+	Translate        = "translate"
+)
+
+// ExampleManifests are the manifests of the models used by the examples, by
+// task, relative to the root of the repository.
+var ExampleManifests = map[string]string{
+	Classify:         "image_classification/model.yml",
+	Detect:           "image_object_detection/model.yml",
+	SegmentInstances: "image_instance_segmentation/model.yml",
+	SegmentSemantic:  "image_semantic_segmentation/model.yml",
+	Enhance:          "image_enhancement/model.yml",
+	CTR:              "dien/model.yml",
+	Translate:        "gnmt/model.yml",
+}
+
+// ExampleManifest loads the manifest of the model used by the example of
+// task from root, the root of the repository.
+func ExampleManifest(root, task string) (*utils.Manifest, error) {
+	path, ok := ExampleManifests[task]
+	if !ok {
+		return nil, fmt.Errorf("task %q has no example model", task)
+	}
+	return utils.LoadManifest(filepath.Join(root, filepath.FromSlash(path)))
+}
+
+// output returns the output key of the model result, failing with a clear
+// error when the manifest did not declare it.
+func output(results map[string]*tf.Tensor, key string) (*tf.Tensor, error) {
+	t, ok := results[key]
+	if !ok {
+		return nil, fmt.Errorf("model has no output %q", key)
+	}
+	return t, nil
+}
+
+// inputType returns the dtype declared for the input key, or def.
+func inputType(m *utils.Manifest, key string, def tf.DataType) tf.DataType {
+	spec, ok := m.Input(key)
+	if !ok || spec.DType == "" {
+		return def
+	}
+	dtype, err := utils.ParseDataType(spec.DType)
+	if err != nil {
+		return def
+	}
+	return dtype
+}
@@ -0,0 +1,19 @@
+package task
+
+import "testing"
+
+func TestExampleManifests(t *testing.T) {
+	for name := range ExampleManifests {
+		m, err := ExampleManifest("..", name)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if m.Task != name {
+			t.Errorf("%s: manifest of task %q", name, m.Task)
+		}
+	}
+	if _, err := ExampleManifest("..", "unknown"); err == nil {
+		t.Error("ExampleManifest of an unknown task succeeded")
+	}
+}
@@ -0,0 +1,216 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	utils "github.com/rai-project/tensorflow-go-examples"
+	"github.com/rai-project/tensorflow-go-examples/gnmt/bpe"
+	"github.com/rai-project/tensorflow-go-examples/gnmt/nmt"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// Translator runs a GNMT translation model. Models either take a batch of
+// source sentences as strings ("source") and return the translated words
+// ("translations"), or take the padded token ids of the sentences and their
+// lengths ("source_ids", "source_length") and return the token ids of the
+// decoder ("sample_ids"), mapped through SourceVocab and TargetVocab. Both
+// may also take the batch size ("batch_size") and the beam width
+// ("beam_width").
+type Translator struct {
+	Model    *utils.Model
+	Manifest *utils.Manifest
+
+	SourceVocab *nmt.Vocab
+	TargetVocab *nmt.Vocab
+	// Tokenize splits punctuation off the words of the source sentences and
+	// joins it back in the translations. It is set by NewTranslator.
+	Tokenize bool
+	// TimeMajor is set if the decoder outputs are [time, batch, beam], as in
+	// graphs trained by nmt with the default time_major. It is set by
+	// NewTranslator.
+	TimeMajor bool
+	// BeamWidth, if positive, is fed to models taking a beam width. Other
+	// models fail unless it is the width they were built with.
+	BeamWidth int
+	// BPE, if set, segments the tokens of the source sentences into the
+	// subwords of models trained on BPE segmented text. JoinSubwords joins
+	// the subwords of the translations back into words.
+	BPE          *bpe.BPE
+	JoinSubwords bool
+}
+
+// NewTranslator loads the model described by manifest from dir.
+func NewTranslator(manifest *utils.Manifest, dir string, options *tf.SessionOptions) (*Translator, error) {
+	model, err := manifest.Load(dir, options)
+	if err != nil {
+		return nil, err
+	}
+	return &Translator{Model: model, Manifest: manifest, Tokenize: true, TimeMajor: true}, nil
+}
+
+// LoadVocabs loads the source and target vocabularies of models fed token
+// ids.
+func (t *Translator) LoadVocabs(source, target string) error {
+	src, err := nmt.LoadVocab(source)
+	if err != nil {
+		return err
+	}
+	tgt, err := nmt.LoadVocab(target)
+	if err != nil {
+		return err
+	}
+	t.SourceVocab, t.TargetVocab = src, tgt
+	return nil
+}
+
+// TakesIDs reports whether the model is fed token ids rather than strings.
+func (t *Translator) TakesIDs() bool {
+	_, ok := t.Model.Input("source_ids")
+	return ok
+}
+
+// Translate translates a batch of sentences.
+func (t *Translator) Translate(sentences []string) ([]string, error) {
+	return t.TranslateContext(context.Background(), sentences)
+}
+
+// TranslateContext is like Translate but returns early with the error of ctx
+// if ctx is done before the model has run.
+func (t *Translator) TranslateContext(ctx context.Context, sentences []string) ([]string, error) {
+	tokens := make([][]string, len(sentences))
+	for i, s := range sentences {
+		if t.Tokenize {
+			tokens[i] = nmt.Tokenize(s)
+		} else {
+			tokens[i] = strings.Fields(s)
+		}
+		if t.BPE != nil {
+			tokens[i] = t.BPE.Segment(tokens[i])
+		}
+	}
+
+	feeds, err := t.feeds(tokens)
+	if err != nil {
+		return nil, err
+	}
+	results, err := t.Model.RunContext(ctx, feeds)
+	if err != nil {
+		return nil, err
+	}
+	words, err := t.words(results, len(sentences))
+	if err != nil {
+		return nil, err
+	}
+
+	translations := make([]string, len(words))
+	for i, w := range words {
+		if t.JoinSubwords {
+			w = bpe.JoinTokens(w)
+		}
+		if t.Tokenize {
+			translations[i] = nmt.Detokenize(w)
+		} else {
+			translations[i] = strings.Join(w, " ")
+		}
+	}
+	return translations, nil
+}
+
+// feeds returns the inputs of the model for a batch of tokenized sentences.
+func (t *Translator) feeds(tokens [][]string) (map[string]*tf.Tensor, error) {
+	feeds := map[string]*tf.Tensor{}
+	if t.TakesIDs() {
+		if t.SourceVocab == nil || t.TargetVocab == nil {
+			return nil, fmt.Errorf("model takes token ids, load the vocabularies with LoadVocabs")
+		}
+		ids := make([][]int32, len(tokens))
+		for i, s := range tokens {
+			ids[i] = t.SourceVocab.Encode(s)
+		}
+		source, length, err := nmt.SourceBatch(ids, t.SourceVocab.ID(nmt.EOS))
+		if err != nil {
+			return nil, err
+		}
+		feeds["source_ids"] = source
+		feeds["source_length"] = length
+	} else {
+		sentences := make([]string, len(tokens))
+		for i, s := range tokens {
+			sentences[i] = strings.Join(s, " ")
+		}
+		source, err := tf.NewTensor(sentences)
+		if err != nil {
+			return nil, err
+		}
+		feeds["source"] = source
+	}
+
+	if _, ok := t.Model.Input("batch_size"); ok {
+		// The GNMT inference graph also takes the batch size.
+		batchSize, err := tf.NewTensor(int64(len(tokens)))
+		if err != nil {
+			return nil, err
+		}
+		feeds["batch_size"] = batchSize
+	}
+	if _, ok := t.Model.Input("beam_width"); ok && t.BeamWidth > 0 {
+		beamWidth, err := tf.NewTensor(int32(t.BeamWidth))
+		if err != nil {
+			return nil, err
+		}
+		feeds["beam_width"] = beamWidth
+	}
+	return feeds, nil
+}
+
+// words returns the tokens of the best hypothesis for each of the n
+// sentences of a batch.
+func (t *Translator) words(results map[string]*tf.Tensor, n int) ([][]string, error) {
+	key := "translations"
+	if t.TakesIDs() {
+		key = "sample_ids"
+	}
+	out, err := output(results, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if v, ok := out.Value().([]string); ok {
+		// One string per translated sentence.
+		words := make([][]string, len(v))
+		for i, s := range v {
+			words[i] = strings.Fields(s)
+		}
+		return words, nil
+	}
+
+	beams, err := nmt.NewBeams(out.Shape(), t.TimeMajor)
+	if err != nil {
+		return nil, err
+	}
+	if beams.Batch != n {
+		return nil, fmt.Errorf("decoder output of shape %v does not hold %d sentences, check the time major setting", out.Shape(), n)
+	}
+	if _, ok := t.Model.Input("beam_width"); !ok && t.BeamWidth > 0 && t.BeamWidth != beams.Width {
+		return nil, fmt.Errorf("the graph decodes with a fixed beam width of %d", beams.Width)
+	}
+	if !t.TakesIDs() {
+		return beams.Words(out, 0)
+	}
+	ids, err := beams.IDs(out, 0)
+	if err != nil {
+		return nil, err
+	}
+	words := make([][]string, len(ids))
+	for i, s := range ids {
+		words[i] = t.TargetVocab.Decode(s)
+	}
+	return words, nil
+}
+
+// Close releases the model.
+func (t *Translator) Close() error {
+	return t.Model.Close()
+}
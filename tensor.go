@@ -0,0 +1,187 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// ReshapeTensor creates a tensor of the given shape from flat, a slice of
+// values in row-major order such as []float32 or []string. An empty shape
+// makes a scalar.
+func ReshapeTensor(flat interface{}, shape []int64) (*tf.Tensor, error) {
+	v := reflect.ValueOf(flat)
+	if v.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("expected a slice, got %T", flat)
+	}
+
+	size := int64(1)
+	for _, dim := range shape {
+		if dim < 0 {
+			return nil, fmt.Errorf("invalid shape %v", shape)
+		}
+		size *= dim
+	}
+	if int64(v.Len()) != size {
+		return nil, fmt.Errorf("%d values do not fit shape %v", v.Len(), shape)
+	}
+
+	if len(shape) == 0 {
+		return tf.NewTensor(v.Index(0).Interface())
+	}
+	return tf.NewTensor(nest(v, shape).Interface())
+}
+
+// nest turns the flat slice v into nested slices of the given shape.
+func nest(v reflect.Value, shape []int64) reflect.Value {
+	if len(shape) == 1 {
+		return v
+	}
+	stride := int(NumElements(shape[1:]))
+	typ := v.Type()
+	for range shape[1:] {
+		typ = reflect.SliceOf(typ)
+	}
+	out := reflect.MakeSlice(typ, int(shape[0]), int(shape[0]))
+	for i := 0; i < int(shape[0]); i++ {
+		out.Index(i).Set(nest(v.Slice(i*stride, (i+1)*stride), shape[1:]))
+	}
+	return out
+}
+
+// FlattenTensor returns the values of t in row-major order as a slice of the
+// Go type of its elements, e.g. []float32 for a tf.Float tensor.
+func FlattenTensor(t *tf.Tensor) interface{} {
+	v := reflect.ValueOf(t.Value())
+	elem := v.Type()
+	for elem.Kind() == reflect.Slice {
+		elem = elem.Elem()
+	}
+	out := reflect.MakeSlice(reflect.SliceOf(elem), 0, int(NumElements(t.Shape())))
+	return flatten(v, out).Interface()
+}
+
+func flatten(v, out reflect.Value) reflect.Value {
+	if v.Kind() != reflect.Slice {
+		return reflect.Append(out, v)
+	}
+	if v.Type().Elem().Kind() != reflect.Slice {
+		return reflect.AppendSlice(out, v)
+	}
+	for i := 0; i < v.Len(); i++ {
+		out = flatten(v.Index(i), out)
+	}
+	return out
+}
+
+// NumElements returns the number of elements of a tensor of the given shape.
+func NumElements(shape []int64) int64 {
+	n := int64(1)
+	for _, dim := range shape {
+		n *= dim
+	}
+	return n
+}
+
+// ConcatTensors concatenates tensors along their first dimension. They must
+// have the same type and agree on every other dimension.
+func ConcatTensors(tensors []*tf.Tensor) (*tf.Tensor, error) {
+	if len(tensors) == 0 {
+		return nil, fmt.Errorf("no tensors to concatenate")
+	}
+	if len(tensors) == 1 {
+		return tensors[0], nil
+	}
+
+	first := tensors[0]
+	shape := append([]int64(nil), first.Shape()...)
+	if len(shape) == 0 {
+		return nil, fmt.Errorf("cannot concatenate scalars")
+	}
+	for _, t := range tensors[1:] {
+		if t.DataType() != first.DataType() || !sameShape(t.Shape()[1:], shape[1:]) {
+			return nil, fmt.Errorf("cannot concatenate %s%v and %s%v",
+				DataTypeName(first.DataType()), first.Shape(), DataTypeName(t.DataType()), t.Shape())
+		}
+		shape[0] += t.Shape()[0]
+	}
+
+	if first.DataType() == tf.String {
+		var flat []string
+		for _, t := range tensors {
+			flat = append(flat, FlattenTensor(t).([]string)...)
+		}
+		return ReshapeTensor(flat, shape)
+	}
+	var buf bytes.Buffer
+	for _, t := range tensors {
+		if _, err := t.WriteContentsTo(&buf); err != nil {
+			return nil, err
+		}
+	}
+	return tf.ReadTensor(first.DataType(), shape, &buf)
+}
+
+// SplitTensor splits t along its first dimension into parts of sizes[i]
+// rows. The sizes must add up to the first dimension of t.
+func SplitTensor(t *tf.Tensor, sizes []int64) ([]*tf.Tensor, error) {
+	shape := t.Shape()
+	var total int64
+	for _, n := range sizes {
+		total += n
+	}
+	if len(shape) == 0 || shape[0] != total {
+		return nil, fmt.Errorf("cannot split %v into %v rows", shape, sizes)
+	}
+	if len(sizes) == 1 {
+		return []*tf.Tensor{t}, nil
+	}
+
+	stride := NumElements(shape[1:])
+	parts := make([]*tf.Tensor, len(sizes))
+	if t.DataType() == tf.String {
+		flat := FlattenTensor(t).([]string)
+		for i, n := range sizes {
+			partShape := append([]int64{n}, shape[1:]...)
+			part, err := ReshapeTensor(flat[:n*stride], partShape)
+			if err != nil {
+				return nil, err
+			}
+			parts[i], flat = part, flat[n*stride:]
+		}
+		return parts, nil
+	}
+
+	var buf bytes.Buffer
+	if _, err := t.WriteContentsTo(&buf); err != nil {
+		return nil, err
+	}
+	data := buf.Bytes()
+	var rowSize int64
+	if total != 0 {
+		rowSize = int64(len(data)) / total
+	}
+	for i, n := range sizes {
+		partShape := append([]int64{n}, shape[1:]...)
+		part, err := tf.ReadTensor(t.DataType(), partShape, bytes.NewReader(data[:n*rowSize]))
+		if err != nil {
+			return nil, err
+		}
+		parts[i], data = part, data[n*rowSize:]
+	}
+	return parts, nil
+}
+
+func sameShape(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
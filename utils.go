@@ -8,12 +8,10 @@ import "C"
 
 import (
 	"bufio"
-	"bytes"
 	"fmt"
 	"image"
 	"image/color"
 	"image/png"
-	"io/ioutil"
 	"log"
 	"os"
 	"reflect"
@@ -71,13 +69,6 @@ func Segment(img *image.RGBA, mask [][]float32, col color.Color, x1, y1, x2, y2
 
 	segScaled := imaging.Resize(seg, int(x2)-int(x1), int(y2)-int(y1), imaging.NearestNeighbor)
 
-	out, _ := os.Create("/tmp/test.png")
-	defer out.Close()
-	err := png.Encode(out, segScaled)
-	if err != nil {
-		log.Println(err)
-	}
-
 	overlay := imaging.Overlay(img, segScaled, image.Pt(int(x1), int(y1)), 0.5)
 	rgba := &image.RGBA{
 		Pix:    overlay.Pix,
@@ -104,10 +95,19 @@ func ToPng(filePath string, imgByte []byte, bounds image.Rectangle) {
 // LABEL UTILITY FUNCTIONS
 
 func LoadLabels(labelsFile string) []string {
+	labels, err := ReadLabels(labelsFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return labels
+}
+
+// ReadLabels reads a label file with one label per line.
+func ReadLabels(labelsFile string) ([]string, error) {
 	var labels []string
 	file, err := os.Open(labelsFile)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	defer file.Close()
 	scanner := bufio.NewScanner(file)
@@ -116,10 +116,10 @@ func LoadLabels(labelsFile string) []string {
 		labels = append(labels, scanner.Text())
 	}
 	if err := scanner.Err(); err != nil {
-		log.Printf("ERROR: failed to read %s: %v", labelsFile, err)
+		return nil, fmt.Errorf("failed to read %s: %v", labelsFile, err)
 	}
 
-	return labels
+	return labels, nil
 }
 
 func GetLabel(idx int, probabilities []float32, classes []float32, labels []string) string {
@@ -176,43 +176,24 @@ func DecodeJpegNormalizeGraph(height int32, width int32) (graph *tf.Graph, input
 	return graph, input, output, err
 }
 
-func MakeTensorFromImage(filename string) (*tf.Tensor, image.Image, error) {
-	b, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	r := bytes.NewReader(b)
-	img, _, err := image.Decode(r)
-
-	if err != nil {
-		return nil, nil, err
-	}
+// ResizeImageGraph resizes a [1, height, width, 3] uint8 image, as returned
+// by DecodeImage, to height and width the way DecodeJpegNormalizeGraph does.
+func ResizeImageGraph(height int32, width int32) (graph *tf.Graph, input, output tf.Output, err error) {
+	s := op.NewScope()
+	input = op.Placeholder(s, tf.Uint8)
+	output =
+		op.Cast(s,
+			op.ResizeBilinear(s, input,
+				op.Const(s.SubScope("size"), []int32{height, width})),
+			tf.Uint8)
+	graph, err = s.Finalize()
+	return graph, input, output, err
+}
 
-	// DecodeJpeg uses a scalar String-valued tensor as input.
-	tensor, err := tf.NewTensor(string(b))
-	if err != nil {
-		return nil, nil, err
-	}
-	// Creates a tensorflow graph to decode the jpeg image
-	graph, input, output, err := DecodeJpegGraph()
-	if err != nil {
-		return nil, nil, err
-	}
-	// Execute that graph to decode this one image
-	session, err := tf.NewSession(graph, nil)
-	if err != nil {
-		return nil, nil, err
-	}
-	defer session.Close()
-	normalized, err := session.Run(
-		map[tf.Output]*tf.Tensor{input: tensor},
-		[]tf.Output{output},
-		nil)
-	if err != nil {
-		return nil, nil, err
-	}
-	return normalized[0], img, nil
+// MakeTensorFromImage decodes the image in filename, in any of the
+// ImageFormats, see DecodeImageFile.
+func MakeTensorFromImage(filename string) (*tf.Tensor, image.Image, error) {
+	return DecodeImageFile(filename)
 }
 
 func max(x, y int) int {
@@ -222,45 +203,40 @@ func max(x, y int) int {
 	return x
 }
 
+// MakeTensorFromResizedImage decodes the image in filename, in any of the
+// ImageFormats, and resizes it so that its longest side is inputSize. It
+// returns the resized image as a uint8 tensor, the decoded image and the
+// size of the resized image.
 func MakeTensorFromResizedImage(filename string, inputSize int32) (*tf.Tensor, image.Image, int, int, error) {
-	b, err := ioutil.ReadFile(filename)
+	decoded, img, err := DecodeImageFile(filename)
 	if err != nil {
 		return nil, nil, 0, 0, err
 	}
-
-	r := bytes.NewReader(b)
-	img, _, err := image.Decode(r)
-	width := img.Bounds().Max.X
-	height := img.Bounds().Max.Y
+	width := img.Bounds().Dx()
+	height := img.Bounds().Dy()
 	resizeRatio := float32(inputSize) / float32(max(width, height))
 	targetWidth := int32(resizeRatio * float32(width))
 	targetHeight := int32(resizeRatio * float32(height))
 
-	// DecodeJpeg uses a scalar String-valued tensor as input.
-	tensor, err := tf.NewTensor(string(b))
+	// Creates a tensorflow graph to resize the decoded image
+	graph, input, output, err := ResizeImageGraph(targetHeight, targetWidth)
 	if err != nil {
 		return nil, nil, 0, 0, err
 	}
-
-	// Creates a tensorflow graph to decode the jpeg image
-	graph, input, output, err := DecodeJpegNormalizeGraph(targetHeight, targetWidth)
-	if err != nil {
-		return nil, nil, 0, 0, err
-	}
-	// Execute that graph to decode this one image
+	// Execute that graph to resize this one image
 	session, err := tf.NewSession(graph, nil)
 	if err != nil {
 		return nil, nil, 0, 0, err
 	}
 	defer session.Close()
-	normalized, err := session.Run(
-		map[tf.Output]*tf.Tensor{input: tensor},
+	resized, err := session.Run(
+		map[tf.Output]*tf.Tensor{input: decoded},
 		[]tf.Output{output},
 		nil)
 	if err != nil {
 		return nil, nil, 0, 0, err
 	}
-	return normalized[0], img, int(targetWidth), int(targetHeight), nil
+	return resized[0], img, int(targetWidth), int(targetHeight), nil
 }
 
 func ReshapeTensorFloats(data [][]float32, shape []int64) (*tf.Tensor, error) {
@@ -344,3 +320,80 @@ func (s Predictions) Swap(i, j int) {
 	// swap index
 	s.Indexes[i], s.Indexes[j] = s.Indexes[j], s.Indexes[i]
 }
+
+// TopK returns the k most probable classes of probs sorted by decreasing
+// probability, ties going to the lower index. Rather than sorting every
+// class, it keeps a heap of the k best classes seen so far. A k that is not
+// positive or exceeds the number of classes returns every class.
+func TopK(probs []float32, k int) Predictions {
+	if k <= 0 || k > len(probs) {
+		k = len(probs)
+	}
+	top := Predictions{Indexes: make([]int, 0, k), Probabilities: make([]float32, 0, k)}
+	if k == 0 {
+		return top
+	}
+	// The root of the heap is the worst of the classes kept.
+	for i, p := range probs {
+		if top.Len() < k {
+			top.Indexes = append(top.Indexes, i)
+			top.Probabilities = append(top.Probabilities, p)
+			top.up(top.Len() - 1)
+		} else if p > top.Probabilities[0] {
+			top.Indexes[0], top.Probabilities[0] = i, p
+			top.down(0, k)
+		}
+	}
+	// Move the worst class to the end until the heap is sorted.
+	for n := k - 1; n > 0; n-- {
+		top.Swap(0, n)
+		top.down(0, n)
+	}
+	return top
+}
+
+// worse reports whether prediction i ranks below prediction j.
+func (s Predictions) worse(i, j int) bool {
+	if s.Probabilities[i] != s.Probabilities[j] {
+		return s.Probabilities[i] < s.Probabilities[j]
+	}
+	return s.Indexes[i] > s.Indexes[j]
+}
+
+func (s Predictions) up(j int) {
+	for j > 0 {
+		i := (j - 1) / 2
+		if !s.worse(j, i) {
+			break
+		}
+		s.Swap(i, j)
+		j = i
+	}
+}
+
+func (s Predictions) down(i, n int) {
+	for {
+		j := 2*i + 1
+		if j >= n {
+			break
+		}
+		if r := j + 1; r < n && s.worse(r, j) {
+			j = r
+		}
+		if !s.worse(j, i) {
+			break
+		}
+		s.Swap(i, j)
+		i = j
+	}
+}
+
+// Above returns the leading predictions whose probability is at least min,
+// for predictions sorted by decreasing probability.
+func (s Predictions) Above(min float32) Predictions {
+	n := 0
+	for n < s.Len() && s.Probabilities[n] >= min {
+		n++
+	}
+	return Predictions{Indexes: s.Indexes[:n], Probabilities: s.Probabilities[:n]}
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestTopK(t *testing.T) {
+	tests := []struct {
+		name  string
+		probs []float32
+		k     int
+		want  []int
+	}{
+		{"top 2", []float32{0.1, 0.5, 0.2, 0.15, 0.05}, 2, []int{1, 2}},
+		{"all", []float32{0.1, 0.5, 0.2}, 3, []int{1, 2, 0}},
+		{"ties to lower index", []float32{0.2, 0.3, 0.2, 0.3}, 3, []int{1, 3, 0}},
+		{"k of 0", []float32{0.1, 0.9}, 0, []int{1, 0}},
+		{"negative k", []float32{0.1, 0.9}, -1, []int{1, 0}},
+		{"k above classes", []float32{0.1, 0.9}, 5, []int{1, 0}},
+		{"no classes", nil, 5, []int{}},
+	}
+	for _, tt := range tests {
+		top := TopK(tt.probs, tt.k)
+		if !reflect.DeepEqual(top.Indexes, tt.want) {
+			t.Errorf("%s: TopK indexes = %v, want %v", tt.name, top.Indexes, tt.want)
+			continue
+		}
+		for i, index := range top.Indexes {
+			if top.Probabilities[i] != tt.probs[index] {
+				t.Errorf("%s: probability %d = %v, want %v", tt.name, i, top.Probabilities[i], tt.probs[index])
+			}
+		}
+	}
+}
+
+func TestTopKMatchesSort(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for n := 1; n <= 50; n++ {
+		probs := make([]float32, n)
+		for i := range probs {
+			// Few distinct values, so that there are ties.
+			probs[i] = float32(r.Intn(8)) / 8
+		}
+		want := make([]int, n)
+		for i := range want {
+			want[i] = i
+		}
+		sort.SliceStable(want, func(i, j int) bool { return probs[want[i]] > probs[want[j]] })
+
+		for _, k := range []int{1, n / 2, n} {
+			if k == 0 {
+				continue
+			}
+			if got := TopK(probs, k).Indexes; !reflect.DeepEqual(got, want[:k]) {
+				t.Errorf("TopK(%v, %d) = %v, want %v", probs, k, got, want[:k])
+			}
+		}
+	}
+}
+
+func TestAbove(t *testing.T) {
+	top := TopK([]float32{0.1, 0.5, 0.2, 0.15}, 0)
+	tests := []struct {
+		min  float32
+		want []int
+	}{
+		{0.6, []int{}},
+		{0.5, []int{1}},
+		{0.15, []int{1, 2, 3}},
+		{0, []int{1, 2, 3, 0}},
+	}
+	for _, tt := range tests {
+		above := top.Above(tt.min)
+		if !reflect.DeepEqual(above.Indexes, tt.want) || len(above.Probabilities) != len(tt.want) {
+			t.Errorf("Above(%v) = %v, want %v", tt.min, above.Indexes, tt.want)
+		}
+	}
+}